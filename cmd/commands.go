@@ -0,0 +1,416 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/davidparks11/file-renamer/pkg/config"
+	"github.com/davidparks11/file-renamer/pkg/fileactions"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever"
+	"github.com/davidparks11/file-renamer/pkg/journal"
+	"github.com/davidparks11/file-renamer/pkg/journal/journaliface"
+	"github.com/davidparks11/file-renamer/pkg/logger"
+	"github.com/davidparks11/file-renamer/pkg/logger/loggeriface"
+	"github.com/robfig/cron/v3"
+)
+
+//command is a subcommand of the cli
+type command struct {
+	name    string
+	summary string
+	run     func(opts *globalOptions, args []string) error
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"run", "renames files once and exits", runCommand},
+		{"daemon", "renames files on the configured cron schedules until interrupted (default)", daemonCommand},
+		{"plan", "prints the renames a run would make without changing any files", planCommand},
+		{"undo", "reverts the renames of a run or a single file", undoCommand},
+		{"status", "shows the schedules and recent runs", statusCommand},
+		{"validate-config", "checks the config file and exits", validateConfigCommand},
+		{"config", "converts config files between json, yaml and toml: config convert", configCommand},
+		{"auth", "gets a new google drive token and saves it to tokenPath", authCommand},
+	}
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+//newFlagSet returns a flag set for a command with usage that names the command
+func newFlagSet(opts *globalOptions, name string, args string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(opts.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [global flags] %s %s\n", os.Args[0], name, args)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+func runCommand(opts *globalOptions, args []string) error {
+	flags := newFlagSet(opts, "run", "[-dry-run] [-job name]")
+	jobName := flags.String("job", "", "only runs the job with this name")
+	dryRun := flags.Bool("dry-run", false, "writes the plan of each job without changing any files, like plan")
+	if err := flags.Parse(args); err != nil {
+		return parseError(err)
+	}
+	cfg, err := loadConfig(opts)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		for _, job := range cfg.JobConfigs() {
+			job.DryRun = true
+		}
+	}
+	return renameOnce(opts, cfg, *jobName)
+}
+
+func planCommand(opts *globalOptions, args []string) error {
+	flags := newFlagSet(opts, "plan", "[-format table|json|csv] [-output path] [-job name]")
+	format := flags.String("format", "", "format of the plan: table, json or csv")
+	output := flags.String("output", "", "file to write the plan to instead of stdout")
+	jobName := flags.String("job", "", "only plans the job with this name")
+	if err := flags.Parse(args); err != nil {
+		return parseError(err)
+	}
+
+	cfg, err := loadConfig(opts)
+	if err != nil {
+		return err
+	}
+	for _, job := range cfg.JobConfigs() {
+		job.DryRun = true
+		if *format != "" {
+			job.PlanFormat = *format
+		}
+		if *output != "" {
+			job.PlanOutput = *output
+		}
+	}
+	return renameOnce(opts, cfg, *jobName)
+}
+
+//renameOnce does a single run of every job, or only the named job if jobName is set.
+//An interrupt stops the job that's running once it finishes the file it's on
+func renameOnce(opts *globalOptions, cfg *config.Config, jobName string) error {
+	jobs, err := selectJobs(cfg, jobName)
+	if err != nil {
+		return err
+	}
+	logService := newLogService(cfg)
+	defer logService.Stop()
+	renameJournal := journal.NewJournal(cfg.JournalPath)
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	//a failing job doesn't stop the others from running
+	failed := 0
+	for i, job := range jobs {
+		if ctx.Err() != nil {
+			logService.Warn(fmt.Sprintf("Interrupted, %d of %d jobs were not run", len(jobs)-i, len(jobs)))
+			failed += len(jobs) - i
+			break
+		}
+		if len(jobs) > 1 && job.DryRun {
+			if err = separatePlans(opts, job); err != nil {
+				return err
+			}
+		}
+		jobLog := jobLogger(logService, job)
+		ft, err := newFileRetriever(jobLog, job)
+		if err == nil {
+			renamer := fileactions.NewProcess(jobLog, ft, renameJournal, job).(*fileactions.Renamer)
+			renamer.SetPlanWriter(opts.stdout)
+			err = renamer.Run(ctx)
+		}
+		if err != nil {
+			jobLog.Error(err.Error())
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d jobs failed, see the logs for details", failed, len(jobs))
+	}
+	return nil
+}
+
+//selectJobs returns the config of every job, or only the named job if name is set
+func selectJobs(cfg *config.Config, name string) ([]*config.Config, error) {
+	if name == "" {
+		return cfg.JobConfigs(), nil
+	}
+	for _, job := range cfg.Jobs {
+		if job.Name == name {
+			return []*config.Config{job}, nil
+		}
+	}
+	return nil, fmt.Errorf("no job named %q", name)
+}
+
+//jobLogger tags the logs of a job with its name when the config has jobs
+func jobLogger(logService loggeriface.Service, job *config.Config) loggeriface.Service {
+	if job.Name == "" {
+		return logService
+	}
+	return logger.NewPrefixLogger(logService, job.Name)
+}
+
+//separatePlans keeps the plans of several jobs apart. Plans written to a file get
+//a file per job, and table plans printed to stdout are headed with the job name
+func separatePlans(opts *globalOptions, job *config.Config) error {
+	if job.PlanOutput != "" {
+		ext := filepath.Ext(job.PlanOutput)
+		job.PlanOutput = strings.TrimSuffix(job.PlanOutput, ext) + "-" + job.Name + ext
+		return nil
+	}
+	if job.PlanFormat != "" && job.PlanFormat != fileactions.PlanFormatTable {
+		return fmt.Errorf("%s plans of several jobs can't share stdout, use -output or -job", job.PlanFormat)
+	}
+	fmt.Fprintf(opts.stdout, "\nJob %s:\n", job.Name)
+	return nil
+}
+
+func undoCommand(opts *globalOptions, args []string) error {
+	flags := newFlagSet(opts, "undo", "-run id | -file id [-job name]")
+	runID := flags.String("run", "", "reverts every rename made by the run with this ID")
+	fileID := flags.String("file", "", "reverts the latest rename of the file with this ID")
+	jobName := flags.String("job", "", "job that made the renames, when the journal doesn't say")
+	if err := flags.Parse(args); err != nil {
+		return parseError(err)
+	}
+	if (*runID == "") == (*fileID == "") {
+		flags.Usage()
+		return usageError{errors.New("exactly one of -run or -file is required")}
+	}
+
+	cfg, err := loadConfig(opts)
+	if err != nil {
+		return err
+	}
+	renameJournal := journal.NewJournal(cfg.JournalPath)
+	if *jobName == "" {
+		entries, err := renameJournal.Entries()
+		if err != nil {
+			return err
+		}
+		*jobName = journaledJob(entries, *runID, *fileID)
+	}
+	if *jobName == "" && len(cfg.Jobs) > 0 {
+		return errors.New("the journal doesn't say which job made the renames, use -job")
+	}
+	jobs, err := selectJobs(cfg, *jobName)
+	if err != nil {
+		return err
+	}
+	job := jobs[0]
+
+	logService := newLogService(cfg)
+	defer logService.Stop()
+	jobLog := jobLogger(logService, job)
+
+	ft, err := newFileRetriever(jobLog, job)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
+	return fileactions.NewUndo(jobLog, ft, renameJournal, *runID, *fileID).Run(ctx)
+}
+
+//journaledJob returns the job recorded for the latest rename of the run or file
+func journaledJob(entries []*journaliface.Entry, runID string, fileID string) string {
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.Action == journaliface.ActionRename && (entry.RunID == runID || entry.FileID == fileID) {
+			return entry.Job
+		}
+	}
+	return ""
+}
+
+//runSummary totals the journal entries of a single run
+type runSummary struct {
+	id       string
+	started  time.Time
+	renamed  int
+	reverted int
+}
+
+func statusCommand(opts *globalOptions, args []string) error {
+	flags := newFlagSet(opts, "status", "[-runs n]")
+	runCount := flags.Int("runs", 10, "number of recent runs to show")
+	if err := flags.Parse(args); err != nil {
+		return parseError(err)
+	}
+
+	cfg, err := loadConfig(opts)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(opts.stdout, 0, 0, 2, ' ', 0)
+	backend := cfg.Backend
+	if backend == "" {
+		backend = config.DriveBackend
+	}
+	fmt.Fprintf(w, "Config:\t%s\n", opts.configPath)
+	fmt.Fprintf(w, "Backend:\t%s\n", backend)
+	if len(cfg.Jobs) == 0 {
+		fmt.Fprintf(w, "Parent:\t%s\n", cfg.ParentDirID)
+	}
+	fmt.Fprintln(w, "\nJOB\tSCHEDULE\tNEXT RUN")
+	for _, job := range cfg.JobConfigs() {
+		name := job.Name
+		if name == "" {
+			name = "-"
+		}
+		for _, spec := range job.CronSchedules {
+			sched, err := cron.ParseStandard(spec)
+			if err != nil {
+				fmt.Fprintf(w, "%s\t%s\tinvalid: %s\n", name, spec, err.Error())
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", name, spec, sched.Next(time.Now()).Format(time.RFC1123))
+		}
+	}
+
+	entries, err := journal.NewJournal(cfg.JournalPath).Entries()
+	if err != nil {
+		return err
+	}
+	runs := summarizeRuns(entries)
+	if len(runs) > *runCount {
+		runs = runs[:*runCount]
+	}
+	fmt.Fprintln(w, "\nRUN ID\tSTARTED\tRENAMED\tREVERTED")
+	for _, run := range runs {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", run.id, run.started.Local().Format(time.RFC1123), run.renamed, run.reverted)
+	}
+	return w.Flush()
+}
+
+//summarizeRuns totals renames per run, newest run first. Reverted counts renames
+//of the run that have since been undone
+func summarizeRuns(entries []*journaliface.Entry) []*runSummary {
+	byID := make(map[string]*runSummary)
+	//run that made the most recent rename of each file
+	renamedBy := make(map[string]*runSummary)
+	var runs []*runSummary
+	for _, entry := range entries {
+		switch entry.Action {
+		case journaliface.ActionRename:
+			run, ok := byID[entry.RunID]
+			if !ok {
+				run = &runSummary{id: entry.RunID, started: entry.Timestamp}
+				byID[entry.RunID] = run
+				runs = append(runs, run)
+			}
+			run.renamed++
+			renamedBy[entry.FileID] = run
+		case journaliface.ActionUndo:
+			if run, ok := renamedBy[entry.FileID]; ok {
+				run.reverted++
+				delete(renamedBy, entry.FileID)
+			}
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].started.After(runs[j].started)
+	})
+	return runs
+}
+
+func validateConfigCommand(opts *globalOptions, args []string) error {
+	if err := newFlagSet(opts, "validate-config", "").Parse(args); err != nil {
+		return parseError(err)
+	}
+	if _, err := loadConfig(opts); err != nil {
+		return err
+	}
+	fmt.Fprintln(opts.stdout, opts.configPath+" is valid")
+	return nil
+}
+
+func configCommand(opts *globalOptions, args []string) error {
+	if len(args) == 0 || args[0] != "convert" {
+		return usageError{errors.New("usage: config convert [-to json|yaml|toml] [input] [output]")}
+	}
+	return convertCommand(opts, args[1:])
+}
+
+//convertCommand translates a config file to another format. The formats come from the
+//file extensions, so -to is only needed when writing to stdout
+func convertCommand(opts *globalOptions, args []string) error {
+	flags := newFlagSet(opts, "config convert", "[-to json|yaml|toml] [input] [output]")
+	to := flags.String("to", "", "format to convert to, defaults to the format of output")
+	if err := flags.Parse(args); err != nil {
+		return parseError(err)
+	}
+
+	input, output := opts.configPath, ""
+	if flags.NArg() > 0 {
+		input = flags.Arg(0)
+	}
+	if flags.NArg() > 1 {
+		output = flags.Arg(1)
+	}
+	if *to == "" {
+		if output == "" {
+			flags.Usage()
+			return usageError{errors.New("-to is required when writing to stdout")}
+		}
+		*to = config.FormatOf(output)
+	}
+
+	data, err := ioutil.ReadFile(input)
+	if err != nil {
+		return err
+	}
+	converted, err := config.Convert(data, config.FormatOf(input), *to)
+	if err != nil {
+		return fmt.Errorf("unable to convert %s: %s", input, err.Error())
+	}
+	if output == "" {
+		_, err = opts.stdout.Write(converted)
+		return err
+	}
+	return ioutil.WriteFile(output, converted, 0644)
+}
+
+func authCommand(opts *globalOptions, args []string) error {
+	if err := newFlagSet(opts, "auth", "").Parse(args); err != nil {
+		return parseError(err)
+	}
+	cfg, err := loadConfig(opts)
+	if err != nil {
+		return err
+	}
+	//the link to authorize with is logged, so it has to reach the console
+	cfg.LogToConsole = true
+	logService := newLogService(cfg)
+	defer logService.Stop()
+
+	if err = fileretriever.Authenticate(logService, cfg); err != nil {
+		return err
+	}
+	fmt.Fprintln(opts.stdout, "Saved token to "+cfg.TokenPath)
+	return nil
+}
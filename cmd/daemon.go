@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/davidparks11/file-renamer/pkg/config"
+	"github.com/davidparks11/file-renamer/pkg/fileactions"
+	"github.com/davidparks11/file-renamer/pkg/fileactions/fileactionsiface"
+	"github.com/davidparks11/file-renamer/pkg/journal"
+	"github.com/davidparks11/file-renamer/pkg/journal/journaliface"
+	"github.com/davidparks11/file-renamer/pkg/logger/loggeriface"
+	"github.com/davidparks11/file-renamer/pkg/schedule"
+	"github.com/davidparks11/file-renamer/pkg/schedule/scheduleiface"
+)
+
+//configPollInterval is how often the daemon checks the config file for changes
+const configPollInterval = 5 * time.Second
+
+//daemon runs every job on its schedules, reloading the config when the file
+//changes or a SIGHUP is received
+type daemon struct {
+	opts      *globalOptions
+	logger    loggeriface.Service
+	scheduler scheduleiface.Scheduler
+	journal   journaliface.Journal
+	//mu guards everything below, which is replaced on reload
+	mu         sync.Mutex
+	config     *config.Config
+	configFile []byte
+	jobs       map[string]*daemonJob
+}
+
+//daemonJob is a job as of the latest config it was changed in
+type daemonJob struct {
+	config    *config.Config
+	logger    loggeriface.Service
+	schedules []scheduleiface.JobID
+	//renamer is made by the first run, so it never overlaps a run of an older version of the job
+	renamer fileactionsiface.Process
+	//running is shared with every version of the job so a reload can't start a second run
+	running *int32
+}
+
+func daemonCommand(opts *globalOptions, args []string) error {
+	if err := newFlagSet(opts, "daemon", "").Parse(args); err != nil {
+		return parseError(err)
+	}
+	cfg, err := loadConfig(opts)
+	if err != nil {
+		return err
+	}
+	configFile, _ := ioutil.ReadFile(opts.configPath)
+
+	//Set up log service
+	logService := newLogService(cfg)
+	logService.Info("Program Start")
+	defer func() {
+		logService.Info("System interrupt exiting program")
+		logService.Stop()
+	}()
+
+	d := &daemon{
+		opts:       opts,
+		logger:     logService,
+		scheduler:  schedule.NewScheduleService(logService),
+		journal:    journal.NewJournal(cfg.JournalPath),
+		config:     cfg,
+		configFile: configFile,
+	}
+	if err = d.apply(cfg); err != nil {
+		return err
+	}
+	for _, job := range d.jobs {
+		if job.config.RunAtLaunch {
+			d.runJob(d.scheduler.Context(), job)
+		}
+	}
+
+	go d.watchConfig()
+	logService.Info("Starting scheduler")
+	d.scheduler.Run()
+	return nil
+}
+
+//runJob runs a job unless a run of it is still in progress. The run stops once ctx is done
+func (d *daemon) runJob(ctx context.Context, job *daemonJob) {
+	if !atomic.CompareAndSwapInt32(job.running, 0, 1) {
+		job.logger.Warn("Skipping run, the previous run is still in progress")
+		return
+	}
+	defer atomic.StoreInt32(job.running, 0)
+
+	if job.renamer == nil {
+		ft, err := newFileRetriever(job.logger, job.config)
+		if err != nil {
+			job.logger.Error(err.Error())
+			return
+		}
+		job.renamer = fileactions.NewProcess(job.logger, ft, d.journal, job.config)
+	}
+	if err := job.renamer.Run(ctx); err != nil {
+		job.logger.Error(err.Error())
+	}
+}
+
+//apply schedules the jobs of cfg in place of the current ones. Jobs whose config is
+//unchanged keep running as they are. If a schedule can't be added, the current jobs are kept
+func (d *daemon) apply(cfg *config.Config) error {
+	jobs := make(map[string]*daemonJob)
+	var added []scheduleiface.JobID
+	for _, jobConfig := range cfg.JobConfigs() {
+		old := d.jobs[jobConfig.Name]
+		if old != nil && reflect.DeepEqual(old.config, jobConfig) {
+			jobs[jobConfig.Name] = old
+			continue
+		}
+
+		job := &daemonJob{
+			config:  jobConfig,
+			logger:  jobLogger(d.logger, jobConfig),
+			running: new(int32),
+		}
+		if old != nil {
+			job.running = old.running
+		}
+		for _, spec := range jobConfig.CronSchedules {
+			id, err := d.scheduler.ScheduleJob(spec, func(ctx context.Context) {
+				d.runJob(ctx, job)
+			})
+			if err != nil {
+				for _, id := range added {
+					d.scheduler.RemoveJob(id)
+				}
+				return err
+			}
+			added = append(added, id)
+			job.schedules = append(job.schedules, id)
+		}
+		jobs[jobConfig.Name] = job
+	}
+
+	//the new schedules are in place before the old ones go, so no tick is missed
+	for name, old := range d.jobs {
+		if jobs[name] == old {
+			continue
+		}
+		for _, id := range old.schedules {
+			d.scheduler.RemoveJob(id)
+		}
+	}
+	d.jobs = jobs
+	return nil
+}
+
+//reload loads the config again and swaps it in. An invalid config is logged and
+//the current one keeps running
+func (d *daemon) reload(reason string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.logger.Info("Reloading config, " + reason)
+	cfg, err := loadConfig(d.opts)
+	if err != nil {
+		d.logger.Error("Keeping the current config: " + err.Error())
+		return
+	}
+	if cfg.LogLevel != d.config.LogLevel || cfg.LogLocation != d.config.LogLocation ||
+		cfg.LogToConsole != d.config.LogToConsole || cfg.JournalPath != d.config.JournalPath {
+		d.logger.Warn("Changes to logging and journalPath take effect after a restart")
+	}
+	if err = d.apply(cfg); err != nil {
+		d.logger.Error("Keeping the current config: " + err.Error())
+		return
+	}
+	d.config = cfg
+	d.logger.Info("Reloaded config")
+}
+
+//watchConfig reloads the config on SIGHUP or when the contents of the file change
+func (d *daemon) watchConfig() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hangup:
+			d.reload("received SIGHUP")
+		case <-ticker.C:
+			d.reloadIfChanged()
+		}
+	}
+}
+
+//reloadIfChanged reloads the config if the contents of the file changed since it was last read
+func (d *daemon) reloadIfChanged() {
+	configFile, err := ioutil.ReadFile(d.opts.configPath)
+	if err != nil {
+		//the file may be mid save, it is read again on the next check
+		return
+	}
+	d.mu.Lock()
+	changed := !bytes.Equal(configFile, d.configFile)
+	d.configFile = configFile
+	d.mu.Unlock()
+	if changed {
+		d.reload(d.opts.configPath + " changed")
+	}
+}
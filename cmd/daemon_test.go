@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/davidparks11/file-renamer/pkg/logger"
+	"github.com/davidparks11/file-renamer/pkg/schedule"
+	"github.com/davidparks11/file-renamer/pkg/schedule/scheduleiface"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Daemon", func() {
+	var (
+		dir       string
+		opts      *globalOptions
+		scheduler *schedule.MockScheduler
+		d         *daemon
+	)
+
+	//writeConfig writes a config for a local job on schedule
+	writeConfig := func(schedule string) {
+		contents := `{
+			"backend": "local",
+			"parentDirID": "` + dir + `",
+			"fileExtensions": ["mov"],
+			"cronSchedules": ["` + schedule + `"]
+		}`
+		Expect(ioutil.WriteFile(opts.configPath, []byte(contents), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "daemon")
+		Expect(err).To(BeNil())
+		opts = &globalOptions{configPath: filepath.Join(dir, "config.json")}
+		writeConfig("0 * * * *")
+
+		cfg, err := loadConfig(opts)
+		Expect(err).To(BeNil())
+		scheduler = &schedule.MockScheduler{}
+		scheduler.On("ScheduleJob", "0 * * * *").Return(scheduleiface.JobID(1), nil)
+		d = &daemon{opts: opts, logger: &logger.MockLogger{}, scheduler: scheduler, config: cfg}
+		Expect(d.apply(cfg)).To(Succeed())
+		d.configFile, err = ioutil.ReadFile(opts.configPath)
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should swap in the schedules of a changed config", func() {
+		scheduler.On("ScheduleJob", "30 * * * *").Return(scheduleiface.JobID(2), nil)
+		scheduler.On("RemoveJob", scheduleiface.JobID(1)).Return()
+		writeConfig("30 * * * *")
+
+		d.reloadIfChanged()
+		Expect(d.config.CronSchedules).To(Equal([]string{"30 * * * *"}))
+		Expect(d.jobs[""].schedules).To(Equal([]scheduleiface.JobID{2}))
+		scheduler.AssertExpectations(GinkgoT())
+	})
+
+	It("should keep the current schedules when the new config is invalid", func() {
+		writeConfig("61 * * * *")
+
+		d.reload("received SIGHUP")
+		Expect(d.config.CronSchedules).To(Equal([]string{"0 * * * *"}))
+		Expect(d.jobs[""].schedules).To(Equal([]scheduleiface.JobID{1}))
+		scheduler.AssertNumberOfCalls(GinkgoT(), "ScheduleJob", 1)
+		scheduler.AssertNotCalled(GinkgoT(), "RemoveJob", scheduleiface.JobID(1))
+	})
+})
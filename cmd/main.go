@@ -1,67 +1,171 @@
 package main
 
 import (
-	"log"
+	"context"
+	"flag"
+	"fmt"
+	"io"
 	"os"
-	"strconv"
+	"os/signal"
+	"syscall"
 
 	"github.com/davidparks11/file-renamer/pkg/config"
 	"github.com/davidparks11/file-renamer/pkg/fileactions"
 	"github.com/davidparks11/file-renamer/pkg/fileretriever"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
 	"github.com/davidparks11/file-renamer/pkg/logger"
 	"github.com/davidparks11/file-renamer/pkg/logger/loggeriface"
-	"github.com/davidparks11/file-renamer/pkg/schedule"
-	"github.com/davidparks11/file-renamer/pkg/schedule/scheduleiface"
 )
 
-var logService loggeriface.Service
-var cfg *config.Config
-var scheduler scheduleiface.Scheduler
+//globalOptions are the flags given before the command name
+type globalOptions struct {
+	configPath   string
+	logLevel     string
+	logToConsole bool
+	//stdout and stderr are where commands write their output, and their usage and errors
+	stdout io.Writer
+	stderr io.Writer
+}
+
+//usageError is returned when a command is called wrong, which exits with status 2. It
+//holds no error when the flag package has already reported the problem
+type usageError struct {
+	error
+}
 
 func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
 
-	cfg, err := config.GetConfig()
-	if err != nil {
-		log.Fatal("Failed to load configuration from config.json\n", err.Error())
+//run runs the command named in args and returns the exit status: 0 when it succeeds,
+//1 when it fails and 2 when it's called wrong
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	opts := &globalOptions{stdout: stdout, stderr: stderr}
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.configPath, "config", "", "path to the config file (default $"+config.ConfigPathEnv+" or "+config.DefaultConfigPath+")")
+	flags.StringVar(&opts.logLevel, "log-level", "", "overrides logLevel from the config: error, warn, info or 1-3")
+	flags.BoolVar(&opts.logToConsole, "log-to-console", false, "logs to the console in addition to log files")
+	flags.Usage = func() { usage(flags) }
+	if err := flags.Parse(args); err != nil {
+		return exitStatus(stderr, parseError(err))
+	}
+	//the flag overrides the config after it's validated, so it's checked on its own
+	if !config.ValidLogLevel(opts.logLevel) {
+		return exitStatus(stderr, usageError{fmt.Errorf("-log-level %q must be 1, 2, 3, error, warn or info", opts.logLevel)})
 	}
+	opts.configPath = config.ResolvePath(opts.configPath)
 
-	var logLevel int
-	//command line override
-	if len(os.Args) == 0 {
-		logLevel, _ = strconv.Atoi(os.Args[0])
-	} else {
-		//get log level from config
-		logLevel = logger.ParseLogLevel(cfg.LogLevel)
+	//running without a command keeps the original behavior of starting the scheduler
+	name := "daemon"
+	args = flags.Args()
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
 	}
 
-	//Set up log service
-	logService = logger.NewLogService(logLevel, cfg.LogLocation, cfg.LogToConsole)
-	logService.Info("Program Start")
-	defer func() {
-		if logService != nil {
-			logService.Info("System interrupt exiting program")
-			logService.Stop()
-		}
-	}()
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(stderr, "unknown command %q\n\n", name)
+		usage(flags)
+		return 2
+	}
+	return exitStatus(stderr, cmd.run(opts, args))
+}
 
-	//Set up drive service
-	ft := fileretriever.NewFileRetriever(logService, cfg)
+//parseError turns an error from parsing flags, which the flag package has already
+//reported, into a usage error. Asking for help isn't an error
+func parseError(err error) error {
+	if err == nil || err == flag.ErrHelp {
+		return nil
+	}
+	return usageError{}
+}
 
-	//Set up file actions
-	fileRenamer := fileactions.NewProcess(logService, ft, cfg)
+//exitStatus reports err and returns the status to exit with
+func exitStatus(stderr io.Writer, err error) int {
+	if err == nil {
+		return 0
+	}
+	if usage, ok := err.(usageError); ok {
+		if usage.error != nil {
+			fmt.Fprintln(stderr, "Error: "+usage.Error())
+		}
+		return 2
+	}
+	fmt.Fprintln(stderr, "Error: "+err.Error())
+	return 1
+}
 
-	//Set up scheduler 
-	scheduler = schedule.NewScheduleService(logService)
+func usage(flags *flag.FlagSet) {
+	out := flags.Output()
+	fmt.Fprintf(out, "Usage: %s [global flags] <command> [command flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-16s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(out, "\nGlobal flags:")
+	flags.PrintDefaults()
+	fmt.Fprintf(out, `
+Configuration precedence, highest first:
+  1. command line flags
+  2. environment variables. Every config field can be set with %s followed by
+     its name in upper snake case, for example %s=folderId or
+     %s=mp4,mov. Lists are comma separated or json arrays
+  3. the config file, found at -config, then $%s, then %s
+  4. defaults
+`, config.EnvPrefix, config.EnvName("parentDirID"), config.EnvName("fileExtensions"), config.ConfigPathEnv, config.DefaultConfigPath)
+	fmt.Fprintf(out, "\nRun '%s <command> -h' for the flags of a command.\n", os.Args[0])
+}
+
+//loadConfig reads and validates the config file and applies the global flag overrides
+func loadConfig(opts *globalOptions) (*config.Config, error) {
+	cfg, problems, err := config.ReadConfig(opts.configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration from %s: %s", opts.configPath, err.Error())
+	}
+	problems = append(problems, fileactions.ValidateConfig(cfg)...)
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid configuration in %s\n%s", opts.configPath, config.NewValidationError(problems).Error())
+	}
 
-	if cfg.RunAtLaunch {
-		fileRenamer.Run()
+	if opts.logLevel != "" {
+		cfg.LogLevel = opts.logLevel
 	}
-	
-	for _, schedule := range cfg.CronSchedules {
-		scheduler.ScheduleJob(schedule, func() {
-			fileRenamer.Run()
-		})
+	if opts.logToConsole {
+		cfg.LogToConsole = true
 	}
-	logService.Info("Starting scheduler")
-	scheduler.Run()
+	return cfg, nil
+}
+
+//newLogService sets up logging as configured
+func newLogService(cfg *config.Config) loggeriface.Service {
+	return logger.NewLogService(logger.ParseLogLevel(cfg.LogLevel), cfg.LogLocation, cfg.LogToConsole)
+}
+
+//newFileRetriever sets up the file retriever for the configured backend
+func newFileRetriever(logService loggeriface.Service, cfg *config.Config) (fileretrieveriface.FileRetriever, error) {
+	switch cfg.Backend {
+	case config.LocalBackend:
+		return fileretriever.NewLocalFileRetriever(logService, cfg), nil
+	case "", config.DriveBackend:
+		return fileretriever.NewFileRetriever(logService, cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown backend %s", cfg.Backend)
+	}
+}
+
+//interruptContext returns a context that's cancelled on SIGINT or SIGTERM, so a command
+//can finish the file it's on and exit cleanly instead of being killed mid update
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(interrupt)
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
 }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/davidparks11/file-renamer/pkg/journal"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Command line", func() {
+	var (
+		dir        string
+		configPath string
+		original   string
+		stdout     *bytes.Buffer
+		stderr     *bytes.Buffer
+	)
+
+	//runWith runs the cli with the test config and returns its exit status
+	runWith := func(args ...string) int {
+		return run(append([]string{"-config", configPath}, args...), stdout, stderr)
+	}
+
+	//writeConfig writes a config for a local job in dir with the given extra fields
+	writeConfig := func(extra string) {
+		contents := `{
+			"backend": "local",
+			"parentDirID": "` + filepath.Join(dir, "p") + `",
+			"persistentWords": ["foo"],
+			"nameDelimiter": "_",
+			"fileExtensions": ["jpg"],
+			"journalPath": "` + filepath.Join(dir, "journal.json") + `",
+			"logLocation": "` + filepath.Join(dir, "logs") + `"` + extra + `
+		}`
+		Expect(ioutil.WriteFile(configPath, []byte(contents), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "cmd")
+		Expect(err).To(BeNil())
+		configPath = filepath.Join(dir, "config.json")
+		writeConfig("")
+		original = filepath.Join(dir, "p", "foo.jpg")
+		Expect(os.MkdirAll(filepath.Dir(original), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(original, []byte("foo"), 0644)).To(Succeed())
+		stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	table.DescribeTable("exit status",
+		func(status int, args ...string) {
+			Expect(runWith(args...)).To(Equal(status), stderr.String())
+			Expect(original).To(BeAnExistingFile())
+		},
+		table.Entry("an unknown command", 2, "rename"),
+		table.Entry("an unknown global flag", 2, "-verbose", "run"),
+		table.Entry("an unknown command flag", 2, "run", "-verbose"),
+		table.Entry("a command flag without its value", 2, "run", "-job"),
+		table.Entry("an unknown log level", 2, "-log-level", "verbose", "run"),
+		table.Entry("help for a command", 0, "run", "-h"),
+		table.Entry("help for the cli", 0, "-h"),
+		table.Entry("a job that isn't in the config", 1, "run", "-job", "nope"),
+		table.Entry("undo without -run or -file", 2, "undo"),
+		table.Entry("undo with both -run and -file", 2, "undo", "-run", "a", "-file", "b"),
+		table.Entry("config without a subcommand", 2, "config"),
+		table.Entry("config convert to stdout without -to", 2, "config", "convert"),
+		table.Entry("config convert of a missing file", 1, "config", "convert", "missing.json", "out.yaml"),
+		table.Entry("validate-config of a valid config", 0, "validate-config"),
+		table.Entry("validate-config with an argument flag", 2, "validate-config", "-strict"),
+	)
+
+	It("should rename files with run and put them back with undo", func() {
+		Expect(runWith("run")).To(Equal(0), stderr.String())
+		Expect(original).NotTo(BeAnExistingFile())
+
+		entries, err := journal.NewJournal(filepath.Join(dir, "journal.json")).Entries()
+		Expect(err).To(BeNil())
+		Expect(entries).To(HaveLen(1))
+		Expect(runWith("undo", "-run", entries[0].RunID)).To(Equal(0), stderr.String())
+		Expect(original).To(BeAnExistingFile())
+	})
+
+	It("should not journal a file that already has its new name", func() {
+		named := filepath.Join(dir, "p", "foo_2020_0831_0.jpg")
+		Expect(os.Rename(original, named)).To(Succeed())
+		captured := time.Date(2020, 8, 31, 12, 0, 0, 0, time.UTC)
+		Expect(os.Chtimes(named, captured, captured)).To(Succeed())
+
+		Expect(runWith("run")).To(Equal(0), stderr.String())
+		Expect(named).To(BeAnExistingFile())
+		entries, err := journal.NewJournal(filepath.Join(dir, "journal.json")).Entries()
+		Expect(err).To(BeNil())
+		Expect(entries).To(BeEmpty())
+	})
+
+	It("should only write the plan with run -dry-run", func() {
+		plan := filepath.Join(dir, "plan.json")
+		writeConfig(`, "planFormat": "json", "planOutput": "` + plan + `"`)
+
+		Expect(runWith("run", "-dry-run")).To(Equal(0), stderr.String())
+		Expect(original).To(BeAnExistingFile())
+		contents, err := ioutil.ReadFile(plan)
+		Expect(err).To(BeNil())
+		Expect(string(contents)).To(ContainSubstring(`"foo.jpg"`))
+		_, err = os.Stat(filepath.Join(dir, "journal.json"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("should print the plan of each job to stdout under its name", func() {
+		writeConfig(`, "jobs": [{"name": "first"}, {"name": "second"}]`)
+
+		Expect(runWith("plan")).To(Equal(0), stderr.String())
+		Expect(original).To(BeAnExistingFile())
+		Expect(stdout.String()).To(ContainSubstring("Job first:"))
+		Expect(stdout.String()).To(ContainSubstring("Job second:"))
+		Expect(stdout.String()).To(ContainSubstring("foo.jpg"))
+	})
+
+	It("should report every problem of an invalid config and exit with 1", func() {
+		writeConfig(`, "cronSchedules": ["61 * * * *"], "logLevel": "loud"`)
+
+		Expect(runWith("validate-config")).To(Equal(1))
+		Expect(stdout.String()).To(BeEmpty())
+		Expect(stderr.String()).To(ContainSubstring("cronSchedules"))
+		Expect(stderr.String()).To(ContainSubstring("logLevel"))
+	})
+
+	It("should say a valid config is valid", func() {
+		Expect(runWith("validate-config")).To(Equal(0))
+		Expect(stdout.String()).To(Equal(configPath + " is valid\n"))
+	})
+
+	It("should convert the config to the format of the output file", func() {
+		output := filepath.Join(dir, "config.yaml")
+		Expect(runWith("config", "convert", configPath, output)).To(Equal(0), stderr.String())
+		contents, err := ioutil.ReadFile(output)
+		Expect(err).To(BeNil())
+		Expect(string(contents)).To(ContainSubstring("parentDirID: " + filepath.Join(dir, "p")))
+
+		Expect(runWith("config", "convert", "-to", "toml")).To(Equal(0), stderr.String())
+		Expect(stdout.String()).To(ContainSubstring(`parentDirID = "` + filepath.Join(dir, "p") + `"`))
+	})
+})
@@ -2,11 +2,16 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
 )
 
 const (
-	configFilePath = "resources/config.json"
+	//DefaultConfigPath is where config.json is read from when no path is given
+	DefaultConfigPath = "resources/config.json"
 )
 
 //Config type represents the json struct to hold this applications Config.
@@ -22,34 +27,337 @@ const (
 //	"credentialsPath": "resources/superSecret/credentials.json",
 //	"tokenPath": "resources/superSuperSecret/token.json",
 //	"runAtLaunch": true,
-//	"logToConsole": true
+//	"logToConsole": true,
+//	"backend": "drive",
+//	"localStatePath": "",
+//	"dryRun": false,
+//	"planFormat": "table",
+//	"planOutput": "",
+//	"journalPath": "resources/journal.jsonl",
+//	"nameTemplate": "{words}{sep}{created:2006-01-02}{sep}{counter:03}{ext}",
+//	"dateSources": ["exif", "imageMediaMetadata", "video", "createdDate", "modifiedDate"],
+//	"retryMaxAttempts": 5,
+//	"retryBaseDelay": "1s",
+//	"retryMaxDelay": "32s",
+//	"retryMaxTotalDelay": "2m",
+//	"readLimitPerMinute": 300,
+//	"readBurst": 1,
+//	"writeLimitPerMinute": 60,
+//	"writeBurst": 1,
+//	"updateWorkers": 4,
+//	"runTimeout": "30m",
+//	"checkpointPath": "resources/checkpoint.json",
+//	"incrementalSync": true,
+//	"changesStatePath": "resources/changes.json",
+//	"persistentWordAliases": {"landscape": ["lndscp", "land-scape"]},
+//	"fuzzyMatchDistance": 1,
+//	"keepStem": true,
+//	"stemMaxLength": 40,
+//	"sanitizeProfile": "portable",
+//	"transliterate": false,
+//	"maxNameLength": 255,
+//	"counterScope": "name",
+//	"counterStart": 0,
+//	"collisionScope": "tree",
+//	"collisionStrategy": "bump",
+//	"duplicatePolicy": "quarantine",
+//	"quarantineFolderID": "duplicates folder id",
+//	"folderTemplate": "{created:2006}/{created:01}",
+//	"destinationFolderID": "archive folder id",
+//	"pairByStem": true,
+//	"renameRules": [{"pattern": "(?i)client-(?P<client>[a-z]+)", "output": "${client}", "case": "upper", "wholeWord": true}],
+//	"jobs": [
+//		{"name": "footage", "parentDirID": "footage folder id", "fileExtensions": ["mp4", "mov"]},
+//		{"name": "stills", "parentDirID": "stills folder id", "fileExtensions": ["jpg"], "cronSchedules": ["0 * * * *"]}
+//	]
 // }
+//
+//Each job in jobs is renamed on its own, using the options given in the job and
+//the top level options for anything it leaves out. Without jobs, the top level
+//options make up the only job
 
 type Config struct {
-	CronSchedules   []string `json:"cronSchedules"`
-	ParentDirID     string   `json:"parentDirID"`
-	PersistentWords []string `json:"persistentWords"`
-	NameDelimiter	string	 `json:"nameDelimiter"`
-	FileExtensions  []string `json:"fileExtensions"`
-	LogLevel        string   `json:"logLevel"`
-	LogLocation     string   `json:"logLocation"`
-	CredentialsPath string   `json:"credentialsPath"`
-	TokenPath       string   `json:"tokenPath"`
-	RunAtLaunch     bool     `json:"RunAtLaunch"`
-	LogToConsole    bool     `json:"logToConsole"`
+	CronSchedules         []string            `json:"cronSchedules"`
+	ParentDirID           string              `json:"parentDirID"`
+	PersistentWords       []string            `json:"persistentWords"`
+	NameDelimiter         string              `json:"nameDelimiter"`
+	FileExtensions        []string            `json:"fileExtensions"`
+	LogLevel              string              `json:"logLevel"`
+	LogLocation           string              `json:"logLocation"`
+	CredentialsPath       string              `json:"credentialsPath"`
+	TokenPath             string              `json:"tokenPath"`
+	RunAtLaunch           bool                `json:"RunAtLaunch"`
+	LogToConsole          bool                `json:"logToConsole"`
+	Backend               string              `json:"backend"`
+	LocalStatePath        string              `json:"localStatePath"`
+	DryRun                bool                `json:"dryRun"`
+	PlanFormat            string              `json:"planFormat"`
+	PlanOutput            string              `json:"planOutput"`
+	JournalPath           string              `json:"journalPath"`
+	NameTemplate          string              `json:"nameTemplate"`
+	DateSources           []string            `json:"dateSources"`
+	RetryMaxAttempts      int                 `json:"retryMaxAttempts"`
+	RetryBaseDelay        string              `json:"retryBaseDelay"`
+	RetryMaxDelay         string              `json:"retryMaxDelay"`
+	RetryMaxTotalDelay    string              `json:"retryMaxTotalDelay"`
+	ReadLimitPerMinute    int                 `json:"readLimitPerMinute"`
+	ReadBurst             int                 `json:"readBurst"`
+	WriteLimitPerMinute   int                 `json:"writeLimitPerMinute"`
+	WriteBurst            int                 `json:"writeBurst"`
+	UpdateWorkers         int                 `json:"updateWorkers"`
+	RunTimeout            string              `json:"runTimeout"`
+	CheckpointPath        string              `json:"checkpointPath"`
+	IncrementalSync       bool                `json:"incrementalSync"`
+	ChangesStatePath      string              `json:"changesStatePath"`
+	RenameRules           []RenameRule        `json:"renameRules"`
+	PersistentWordAliases map[string][]string `json:"persistentWordAliases"`
+	FuzzyMatchDistance    int                 `json:"fuzzyMatchDistance"`
+	KeepStem              bool                `json:"keepStem"`
+	StemMaxLength         int                 `json:"stemMaxLength"`
+	SanitizeProfile       string              `json:"sanitizeProfile"`
+	Transliterate         bool                `json:"transliterate"`
+	MaxNameLength         int                 `json:"maxNameLength"`
+	CounterScope          string              `json:"counterScope"`
+	CounterStart          int                 `json:"counterStart"`
+	CollisionScope        string              `json:"collisionScope"`
+	CollisionStrategy     string              `json:"collisionStrategy"`
+	DuplicatePolicy       string              `json:"duplicatePolicy"`
+	QuarantineFolderID    string              `json:"quarantineFolderID"`
+	FolderTemplate        string              `json:"folderTemplate"`
+	DestinationFolderID   string              `json:"destinationFolderID"`
+	PairByStem            bool                `json:"pairByStem"`
+	Name                  string              `json:"name"`
+	Jobs                  []*Config           `json:"jobs"`
+}
+
+//RenameRule picks part of a file name out with a regular expression to keep in the
+//new name, after any persistent words. Example:
+// {
+//	"pattern": "shoot[ _-]?(?P<shoot>\\d+)",
+//	"output": "S${shoot}",
+//	"case": "upper",
+//	"wholeWord": true
+// }
+type RenameRule struct {
+	//Pattern is matched against the whole file name, use (?i) to ignore case
+	Pattern string `json:"pattern"`
+	//Output is what's kept, with ${group} replaced by the named capture group. Defaults to the whole match
+	Output string `json:"output"`
+	//Case is lower, upper or title. The text is kept as matched if empty
+	Case string `json:"case"`
+	//WholeWord only matches text bounded by the start or end of the name or a character other than a letter or digit
+	WholeWord bool `json:"wholeWord"`
+}
+
+const (
+	//ProfilePosix only keeps / and NUL out of names. This is the default profile
+	ProfilePosix = "posix"
+	//ProfileWindows makes names windows can create, without <>:"/\|?*, control characters,
+	//trailing dots and spaces, or reserved names such as CON
+	ProfileWindows = "windows"
+	//ProfileMacOS keeps : out of names, which finder shows as /
+	ProfileMacOS = "macos"
+	//ProfilePortable makes names safe on windows, macos and posix file systems
+	ProfilePortable = "portable"
+)
+
+const (
+	//CounterScopeName numbers files that would otherwise get the same name. This is the default scope
+	CounterScopeName = "name"
+	//CounterScopeDay numbers every file captured on the same day, whatever its words
+	CounterScopeDay = "day"
+	//CounterScopeWords numbers every file with the same words, whatever its date
+	CounterScopeWords = "words"
+	//CounterScopeGlobal numbers every file of a run
+	CounterScopeGlobal = "global"
+)
+
+const (
+	//CollisionScopeTree treats a name as taken when any file under parentDirID has it. This is the default scope
+	CollisionScopeTree = "tree"
+	//CollisionScopeFolder treats a name as taken only when a file in the same folder has it
+	CollisionScopeFolder = "folder"
+)
+
+const (
+	//CollisionBump moves on to the next counter when a name is taken. This is the default strategy without incremental sync
+	CollisionBump = "bump"
+	//CollisionSkip leaves a file with its old name when its new name is taken
+	CollisionSkip = "skip"
+	//CollisionFail stops the run before anything is renamed when a new name is taken
+	CollisionFail = "fail"
+	//CollisionIgnore doesn't check new names against files file-renamer didn't name, which saves listing the whole tree.
+	//This is the default strategy with incremental sync
+	CollisionIgnore = "ignore"
+)
+
+const (
+	//DuplicateRename renames duplicate files like any other file
+	DuplicateRename = "rename"
+	//DuplicateTag adds a dup marker to the names of duplicate files
+	DuplicateTag = "tag"
+	//DuplicateQuarantine moves duplicate files to quarantineFolderID
+	DuplicateQuarantine = "quarantine"
+	//DuplicateTrash moves duplicate files to the drive trash
+	DuplicateTrash = "trash"
+)
+
+const (
+	//CaseLower lower cases the output of a rename rule
+	CaseLower = "lower"
+	//CaseUpper upper cases the output of a rename rule
+	CaseUpper = "upper"
+	//CaseTitle capitalizes each word in the output of a rename rule
+	CaseTitle = "title"
+)
+
+const (
+	//DriveBackend renames files in google drive. This is the default backend
+	DriveBackend = "drive"
+	//LocalBackend renames files in a directory on disk
+	LocalBackend = "local"
+)
+
+//UsesDateSource returns true if source is in the configured date source chain
+func (c *Config) UsesDateSource(source string) bool {
+	for _, s := range c.DateSources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+//JobConfigs returns the config of every job, or the config itself if it has no jobs
+func (c *Config) JobConfigs() []*Config {
+	if len(c.Jobs) == 0 {
+		return []*Config{c}
+	}
+	return c.Jobs
 }
 
 //GetConfig returns a config struct after reading config.json
 func GetConfig() (*Config, error) {
-	configFile, err := ioutil.ReadFile(configFilePath)
+	return LoadConfig(DefaultConfigPath)
+}
+
+//LoadConfig returns a config struct after reading the config file at path, in the
+//format given by its extension (json, yaml or toml), and applying any overrides from FILE_RENAMER_* environment variables.
+//If the config isn't valid, a ValidationError listing every problem is returned
+func LoadConfig(path string) (*Config, error) {
+	config, p, err := ReadConfig(path)
 	if err != nil {
 		return nil, err
 	}
+	if err = problems(p).err(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+//ReadConfig reads, overrides and normalizes the config file at path like LoadConfig,
+//but returns any problems found alongside the config so callers can add their own
+//checks before reporting them. The error is only set if the file can't be read at all
+func ReadConfig(path string) (*Config, []Problem, error) {
+	configFile, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	//yaml and toml are read as json, so every format gets the same checks
+	configFile, err = toJSON(configFile, FormatOf(path))
+	if err != nil {
+		return nil, nil, err
+	}
+	var p problems
+	p = append(p, unknownKeys(configFile, reflect.TypeOf(Config{}), "")...)
+
 	config := Config{}
-	err = json.Unmarshal([]byte(configFile), &config)
+	if err = config.decodeFields(configFile, "", &p); err != nil {
+		return nil, nil, err
+	}
+	//the environment overrides the top level options before jobs are merged, so jobs
+	//inherit it like any other top level option and keep what they set themselves
+	if err = config.ApplyEnv(os.LookupEnv); err != nil {
+		return nil, nil, err
+	}
+	if err = config.mergeJobs(configFile, &p); err != nil {
+		return nil, nil, err
+	}
+
+	config.Normalize()
+	if err = config.Validate(); err != nil {
+		p = append(p, err.(*ValidationError).Problems...)
+	}
+	return &config, p, nil
+}
+
+//mergeJobs replaces each job with a copy of the top level options overwritten by the
+//options given in the job, so jobs only need to list what makes them different
+func (c *Config) mergeJobs(configFile []byte, p *problems) error {
+	var raw struct {
+		Jobs []json.RawMessage `json:"jobs"`
+	}
+	err := json.Unmarshal(configFile, &raw)
+	if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+		p.add("jobs", "expected a list of jobs, got a %s", typeErr.Value)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	c.Jobs = nil
+	//jobs start from an encoded copy so decoding into them can't change the lists they share with c
+	top := *c
+	top.Name = ""
+	defaults, err := json.Marshal(top)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	for i, jobFile := range raw.Jobs {
+		job := Config{}
+		if err = json.Unmarshal(defaults, &job); err != nil {
+			return err
+		}
+		if err = job.decodeFields(jobFile, fmt.Sprintf("jobs[%d]", i), p); err != nil {
+			return err
+		}
+		c.Jobs = append(c.Jobs, &job)
+	}
+	return nil
+}
 
-	return &config, nil
+//decodeFields decodes a json object into c a field at a time, so every value of the wrong
+//type is reported rather than only the first. Problems are reported under path, and
+//jobs are left to mergeJobs, which decodes each job on its own
+func (c *Config) decodeFields(data []byte, path string, p *problems) error {
+	var object map[string]json.RawMessage
+	err := json.Unmarshal(data, &object)
+	if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+		p.add(path, "expected an object, got a %s", typeErr.Value)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(c).Elem()
+	for key, value := range object {
+		//unknown keys are reported on their own
+		field, ok := fieldForKey(v.Type(), key)
+		if !ok || field.Name == "Jobs" {
+			continue
+		}
+		err = json.Unmarshal(value, v.FieldByIndex(field.Index).Addr().Interface())
+		if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+			fieldPath := strings.Split(field.Tag.Get("json"), ",")[0]
+			if path != "" {
+				fieldPath = path + "." + fieldPath
+			}
+			if typeErr.Field != "" {
+				fieldPath += "." + typeErr.Field
+			}
+			p.add(fieldPath, "expected a %s, got a %s", typeErr.Type.String(), typeErr.Value)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	//ConfigPathEnv names the environment variable holding the path to the config file
+	ConfigPathEnv = "FILE_RENAMER_CONFIG"
+	//EnvPrefix starts the name of every environment variable that overrides a config field
+	EnvPrefix = "FILE_RENAMER_"
+)
+
+//ResolvePath returns the config file path from the flag value, then FILE_RENAMER_CONFIG,
+//then the default path
+func ResolvePath(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if path := os.Getenv(ConfigPathEnv); path != "" {
+		return path
+	}
+	return DefaultConfigPath
+}
+
+//EnvName returns the environment variable that overrides the field with the json key,
+//for example parentDirID is overridden by FILE_RENAMER_PARENT_DIR_ID
+func EnvName(jsonKey string) string {
+	var name strings.Builder
+	runes := []rune(jsonKey)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				name.WriteRune('_')
+			}
+		}
+		name.WriteRune(unicode.ToUpper(r))
+	}
+	return EnvPrefix + name.String()
+}
+
+//ApplyEnv overrides fields of the config with any matching environment variables found
+//by lookup. Lists are given comma separated or as a json array
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		//jobs are merged with the options around them, so they can only be given in the file
+		if key == "" || key == "-" || key == "jobs" {
+			continue
+		}
+		name := EnvName(key)
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := setFromEnv(v.Field(i), value); err != nil {
+			return fmt.Errorf("%s: %s", name, err.Error())
+		}
+	}
+	return nil
+}
+
+func setFromEnv(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(value), "[") {
+			var items []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			field.Set(reflect.ValueOf(items))
+			return nil
+		}
+		return json.Unmarshal([]byte(value), field.Addr().Interface())
+	default:
+		//anything else, such as objects, is given as json
+		return json.Unmarshal([]byte(value), field.Addr().Interface())
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Environment overrides", func() {
+	Describe("EnvName()", func() {
+		It("should convert json keys to upper snake case", func() {
+			Expect(EnvName("parentDirID")).To(Equal("FILE_RENAMER_PARENT_DIR_ID"))
+			Expect(EnvName("RunAtLaunch")).To(Equal("FILE_RENAMER_RUN_AT_LAUNCH"))
+			Expect(EnvName("readLimitPerMinute")).To(Equal("FILE_RENAMER_READ_LIMIT_PER_MINUTE"))
+		})
+	})
+
+	Describe("ApplyEnv()", func() {
+		lookup := func(env map[string]string) func(string) (string, bool) {
+			return func(name string) (string, bool) {
+				value, ok := env[name]
+				return value, ok
+			}
+		}
+
+		It("should override strings, bools, ints and lists", func() {
+			cfg := &Config{ParentDirID: "fromFile", FileExtensions: []string{"png"}}
+			err := cfg.ApplyEnv(lookup(map[string]string{
+				"FILE_RENAMER_PARENT_DIR_ID":      "fromEnv",
+				"FILE_RENAMER_RUN_AT_LAUNCH":      "true",
+				"FILE_RENAMER_RETRY_MAX_ATTEMPTS": "3",
+				"FILE_RENAMER_FILE_EXTENSIONS":    "mp4, mov",
+				"FILE_RENAMER_PERSISTENT_WORDS":   `["work", "play"]`,
+			}))
+			Expect(err).To(BeNil())
+			Expect(cfg.ParentDirID).To(Equal("fromEnv"))
+			Expect(cfg.RunAtLaunch).To(BeTrue())
+			Expect(cfg.RetryMaxAttempts).To(Equal(3))
+			Expect(cfg.FileExtensions).To(Equal([]string{"mp4", "mov"}))
+			Expect(cfg.PersistentWords).To(Equal([]string{"work", "play"}))
+		})
+
+		It("should name the variable when a value can't be parsed", func() {
+			err := (&Config{}).ApplyEnv(lookup(map[string]string{"FILE_RENAMER_DRY_RUN": "maybe"}))
+			Expect(err).To(MatchError(ContainSubstring("FILE_RENAMER_DRY_RUN")))
+		})
+	})
+})
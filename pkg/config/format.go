@@ -0,0 +1,122 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	//FormatJSON is a config written in json, the default for unknown extensions
+	FormatJSON = "json"
+	//FormatYAML is a config written in yaml, which allows comments
+	FormatYAML = "yaml"
+	//FormatTOML is a config written in toml, which allows comments
+	FormatTOML = "toml"
+)
+
+//FormatOf returns the format of the config file at path from its extension
+func FormatOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatJSON
+	}
+}
+
+//toJSON translates a config file in format to json, so every format is decoded
+//and validated the same way
+func toJSON(data []byte, format string) ([]byte, error) {
+	if format == FormatJSON {
+		return data, nil
+	}
+	value, err := decode(data, format)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+//Convert translates a config file from one format to another. Comments are not kept
+func Convert(data []byte, from string, to string) ([]byte, error) {
+	value, err := decode(data, from)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	switch to {
+	case FormatJSON:
+		encoder := json.NewEncoder(&out)
+		encoder.SetIndent("", "    ")
+		err = encoder.Encode(value)
+	case FormatYAML:
+		encoder := yaml.NewEncoder(&out)
+		encoder.SetIndent(2)
+		err = encoder.Encode(value)
+	case FormatTOML:
+		err = toml.NewEncoder(&out).Encode(value)
+	default:
+		err = fmt.Errorf("unknown config format %q, must be %s, %s or %s", to, FormatJSON, FormatYAML, FormatTOML)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+//decode reads a config file in format into plain maps, slices and values
+func decode(data []byte, format string) (map[string]interface{}, error) {
+	value := make(map[string]interface{})
+	var err error
+	switch format {
+	case FormatJSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&value)
+	case FormatYAML:
+		err = yaml.Unmarshal(data, &value)
+	case FormatTOML:
+		_, err = toml.Decode(string(data), &value)
+	default:
+		err = fmt.Errorf("unknown config format %q, must be %s, %s or %s", format, FormatJSON, FormatYAML, FormatTOML)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", format, err.Error())
+	}
+	return plainValue(value).(map[string]interface{}), nil
+}
+
+//plainValue drops nulls, which toml can't hold, and turns json numbers back into
+//ints or floats so they aren't written as strings
+func plainValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if item == nil {
+				delete(v, key)
+				continue
+			}
+			v[key] = plainValue(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = plainValue(item)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return value
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config formats", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "config")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	write := func(name string, contents string) string {
+		path := filepath.Join(dir, name)
+		Expect(ioutil.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+		return path
+	}
+
+	It("should read yaml with comments", func() {
+		cfg, err := LoadConfig(write("config.yml", `
+backend: local
+parentDirID: `+dir+`
+# kept so clips can be found by client
+persistentWords: [acme]
+fileExtensions: [MP4]
+retryMaxAttempts: 3
+`))
+		Expect(err).To(BeNil())
+		Expect(cfg.PersistentWords).To(Equal([]string{"acme"}))
+		Expect(cfg.FileExtensions).To(Equal([]string{"mp4"}))
+		Expect(cfg.RetryMaxAttempts).To(Equal(3))
+	})
+
+	It("should read toml jobs", func() {
+		cfg, err := LoadConfig(write("config.toml", `
+backend = "local"
+fileExtensions = ["mp4"]
+
+[[jobs]]
+name = "footage" # the camera uploads
+parentDirID = "`+dir+`"
+`))
+		Expect(err).To(BeNil())
+		Expect(cfg.Jobs).To(HaveLen(1))
+		Expect(cfg.Jobs[0].ParentDirID).To(Equal(dir))
+	})
+
+	It("should validate yaml like json", func() {
+		_, err := LoadConfig(write("config.yaml", "backend: local\nparentDirID: "+dir+"\nfileExtension: [mp4]\n"))
+		Expect(fields(err)).To(Equal([]string{"fileExtension", "fileExtensions"}))
+	})
+
+	Describe("Convert()", func() {
+		It("should keep every value through each format", func() {
+			original := []byte(`{"cronSchedules": ["0 * * * *"], "retryMaxAttempts": 5, "readLimitPerMinute": 120, "dryRun": true, "jobs": [{"name": "a"}]}`)
+			yamlConfig, err := Convert(original, FormatJSON, FormatYAML)
+			Expect(err).To(BeNil())
+			tomlConfig, err := Convert(yamlConfig, FormatYAML, FormatTOML)
+			Expect(err).To(BeNil())
+			Expect(string(tomlConfig)).To(ContainSubstring("retryMaxAttempts = 5\n"))
+			jsonConfig, err := Convert(tomlConfig, FormatTOML, FormatJSON)
+			Expect(err).To(BeNil())
+			Expect(jsonConfig).To(MatchJSON(original))
+		})
+	})
+})
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Jobs", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "config")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	load := func(contents string) (*Config, error) {
+		path := filepath.Join(dir, "config.json")
+		Expect(ioutil.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+		return LoadConfig(path)
+	}
+
+	It("should fill in each job from the top level options", func() {
+		cfg, err := load(`{
+			"backend": "local",
+			"parentDirID": "` + dir + `",
+			"fileExtensions": ["mp4"],
+			"persistentWords": ["keep"],
+			"cronSchedules": ["0 * * * *"],
+			"jobs": [
+				{"name": "footage", "fileExtensions": ["MOV"]},
+				{"name": "stills", "fileExtensions": ["jpg"], "persistentWords": [], "cronSchedules": ["30 * * * *"]}
+			]
+		}`)
+		Expect(err).To(BeNil())
+		Expect(cfg.JobConfigs()).To(HaveLen(2))
+
+		footage, stills := cfg.Jobs[0], cfg.Jobs[1]
+		Expect(footage.Name).To(Equal("footage"))
+		Expect(footage.ParentDirID).To(Equal(dir))
+		Expect(footage.FileExtensions).To(Equal([]string{"mov"}))
+		Expect(footage.PersistentWords).To(Equal([]string{"keep"}))
+		Expect(footage.CronSchedules).To(Equal([]string{"0 * * * *"}))
+		Expect(stills.PersistentWords).To(BeEmpty())
+		Expect(stills.CronSchedules).To(Equal([]string{"30 * * * *"}))
+		Expect(cfg.FileExtensions).To(Equal([]string{"mp4"}))
+	})
+
+	It("should treat a config without jobs as a single job", func() {
+		cfg, err := load(`{"backend": "local", "parentDirID": "` + dir + `", "fileExtensions": ["mp4"]}`)
+		Expect(err).To(BeNil())
+		Expect(cfg.JobConfigs()).To(Equal([]*Config{cfg}))
+	})
+
+	It("should report job problems with the index of the job", func() {
+		_, err := load(`{
+			"backend": "local",
+			"fileExtensions": ["mp4"],
+			"jobs": [
+				{"name": "footage", "parentDirID": "` + dir + `", "nameDelimiter": 1},
+				{"name": "footage", "parentDirID": "` + dir + `", "fileExtension": ["jpg"]}
+			]
+		}`)
+		Expect(fields(err)).To(Equal([]string{"jobs[0].nameDelimiter", "jobs[1].fileExtension", "jobs[1].name"}))
+	})
+
+	It("should need a checkpoint file for each job", func() {
+		_, err := load(`{
+			"backend": "local",
+			"fileExtensions": ["mp4"],
+			"checkpointPath": "` + filepath.Join(dir, "checkpoint.json") + `",
+			"jobs": [
+				{"name": "footage", "parentDirID": "` + dir + `"},
+				{"name": "stills", "parentDirID": "` + dir + `"}
+			]
+		}`)
+		Expect(fields(err)).To(Equal([]string{"jobs[1].checkpointPath"}))
+	})
+
+	It("should let the environment override the top level options jobs inherit, not what jobs set", func() {
+		footage, stills := filepath.Join(dir, "footage"), filepath.Join(dir, "stills")
+		Expect(os.Mkdir(footage, 0755)).To(Succeed())
+		Expect(os.Mkdir(stills, 0755)).To(Succeed())
+		os.Setenv("FILE_RENAMER_PARENT_DIR_ID", dir)
+		defer os.Unsetenv("FILE_RENAMER_PARENT_DIR_ID")
+		cfg, err := load(`{
+			"backend": "local",
+			"fileExtensions": ["mp4"],
+			"jobs": [
+				{"name": "footage", "parentDirID": "` + footage + `"},
+				{"name": "stills", "parentDirID": "` + stills + `"},
+				{"name": "rest"}
+			]
+		}`)
+		Expect(err).To(BeNil())
+		Expect(cfg.Jobs[0].ParentDirID).To(Equal(footage))
+		Expect(cfg.Jobs[1].ParentDirID).To(Equal(stills))
+		Expect(cfg.Jobs[2].ParentDirID).To(Equal(dir))
+	})
+
+	It("should need jobs sharing credentials to share rate limits", func() {
+		credentials := filepath.Join(dir, "credentials.json")
+		Expect(ioutil.WriteFile(credentials, []byte("{}"), 0644)).To(Succeed())
+		_, err := load(`{
+			"credentialsPath": "` + credentials + `",
+			"parentDirID": "folder",
+			"fileExtensions": ["mp4"],
+			"writeLimitPerMinute": 60,
+			"jobs": [
+				{"name": "footage"},
+				{"name": "stills", "readLimitPerMinute": 300},
+				{"name": "scans", "writeLimitPerMinute": 120}
+			]
+		}`)
+		Expect(fields(err)).To(Equal([]string{"jobs[1].readLimitPerMinute", "jobs[2].writeLimitPerMinute"}))
+	})
+})
@@ -0,0 +1,479 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/robfig/cron/v3"
+)
+
+//Problem is a single thing wrong with a config, found at Field
+type Problem struct {
+	Field   string
+	Message string
+}
+
+func (p Problem) String() string {
+	return p.Field + ": " + p.Message
+}
+
+//ValidationError holds every problem found in a config
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (v *ValidationError) Error() string {
+	lines := make([]string, len(v.Problems))
+	for i, problem := range v.Problems {
+		lines[i] = "  " + problem.String()
+	}
+	return fmt.Sprintf("config has %d problems:\n%s", len(v.Problems), strings.Join(lines, "\n"))
+}
+
+//problems collects problems while validating
+type problems []Problem
+
+func (p *problems) add(field string, format string, args ...interface{}) {
+	*p = append(*p, Problem{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+//err returns a ValidationError if any problems were found
+func (p problems) err() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return NewValidationError(p)
+}
+
+//NewValidationError returns a ValidationError listing found. Problems are sorted by
+//field so reports are stable, since some checks range over maps
+func NewValidationError(found []Problem) *ValidationError {
+	sorted := append([]Problem{}, found...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Field < sorted[j].Field
+	})
+	return &ValidationError{Problems: sorted}
+}
+
+//unknownKeys returns the path of every key in the json that doesn't match a field of t.
+//Keys are matched case insensitively, the same way encoding/json matches them
+func unknownKeys(data []byte, t reflect.Type, path string) []Problem {
+	var found []Problem
+	switch t.Kind() {
+	case reflect.Ptr:
+		return unknownKeys(data, t.Elem(), path)
+	case reflect.Slice:
+		var items []json.RawMessage
+		if json.Unmarshal(data, &items) != nil {
+			return nil
+		}
+		for i, item := range items {
+			found = append(found, unknownKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case reflect.Struct:
+		var object map[string]json.RawMessage
+		if json.Unmarshal(data, &object) != nil {
+			return nil
+		}
+		for key, value := range object {
+			field, ok := fieldForKey(t, key)
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+			if !ok {
+				found = append(found, Problem{Field: fieldPath, Message: "unknown option"})
+				continue
+			}
+			found = append(found, unknownKeys(value, field.Type, fieldPath)...)
+		}
+	}
+	return found
+}
+
+func fieldForKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		if name != "-" && strings.EqualFold(name, key) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+//Normalize cleans up values that have more than one way of being written.
+//File extensions lose their leading dots and are lower cased
+func (c *Config) Normalize() {
+	c.FileExtensions = normalizeExtensions(c.FileExtensions)
+	for _, job := range c.Jobs {
+		job.Normalize()
+	}
+}
+
+func normalizeExtensions(extensions []string) []string {
+	var normalized []string
+	seen := make(map[string]bool)
+	for _, ext := range extensions {
+		ext = strings.ToLower(strings.TrimLeft(strings.TrimSpace(ext), "."))
+		if ext == "" || seen[ext] {
+			continue
+		}
+		seen[ext] = true
+		normalized = append(normalized, ext)
+	}
+	return normalized
+}
+
+var knownDateSources = []string{"exif", "imageMediaMetadata", "video", "createdDate", "modifiedDate"}
+
+//Validate checks the config and returns a ValidationError listing every problem found.
+//Problems in a job are reported with the index of the job, such as jobs[1].parentDirID
+func (c *Config) Validate() error {
+	var p problems
+	c.validateShared(&p)
+	if len(c.Jobs) == 0 {
+		c.validateJob(&p, "")
+		return p.err()
+	}
+
+	names := make(map[string]bool)
+	changesStatePaths := make(map[string]string)
+	checkpointPaths := make(map[string]string)
+	byCredentials := make(map[string]*Config)
+	for i, job := range c.Jobs {
+		prefix := fmt.Sprintf("jobs[%d].", i)
+		job.validateJob(&p, prefix)
+		if len(job.Jobs) > 0 {
+			p.add(prefix+"jobs", "jobs can't have jobs of their own")
+		}
+		switch {
+		case strings.TrimSpace(job.Name) == "":
+			p.add(prefix+"name", "is required when there is more than one job")
+		case names[job.Name]:
+			p.add(prefix+"name", "%q is used by another job", job.Name)
+		}
+		names[job.Name] = true
+		//jobs sharing a changes state would throw each other's state away on every run
+		if job.IncrementalSync && job.Backend != LocalBackend {
+			if other, ok := changesStatePaths[job.ChangesStatePath]; ok {
+				p.add(prefix+"changesStatePath", "is the same as job %q, each job needs its own", other)
+			}
+			changesStatePaths[job.ChangesStatePath] = job.Name
+		}
+		//a job would resume the plan of another job, or overwrite it
+		if job.CheckpointPath != "" {
+			if other, ok := checkpointPaths[job.CheckpointPath]; ok {
+				p.add(prefix+"checkpointPath", "is the same as job %q, each job needs its own", other)
+			}
+			checkpointPaths[job.CheckpointPath] = job.Name
+		}
+		//jobs using the same credentials share one quota, so they can't ask for different limits
+		if job.Backend != LocalBackend {
+			credentials := job.CredentialsPath
+			if abs, err := filepath.Abs(credentials); err == nil {
+				credentials = abs
+			}
+			if other, ok := byCredentials[credentials]; ok {
+				job.checkSameLimits(&p, prefix, other)
+			} else {
+				byCredentials[credentials] = job
+			}
+		}
+	}
+	return p.err()
+}
+
+//checkSameLimits reports each rate limit of c that differs from the one of other
+func (c *Config) checkSameLimits(p *problems, prefix string, other *Config) {
+	for field, limits := range map[string][2]int{
+		"readLimitPerMinute":  {c.ReadLimitPerMinute, other.ReadLimitPerMinute},
+		"readBurst":           {c.ReadBurst, other.ReadBurst},
+		"writeLimitPerMinute": {c.WriteLimitPerMinute, other.WriteLimitPerMinute},
+		"writeBurst":          {c.WriteBurst, other.WriteBurst},
+	} {
+		if limits[0] != limits[1] {
+			p.add(prefix+field, "is %d but job %q has %d, jobs using the same credentials share one rate limit", limits[0], other.Name, limits[1])
+		}
+	}
+}
+
+//ValidLogLevel returns true for the log levels the logger understands, or an empty level
+func ValidLogLevel(level string) bool {
+	switch strings.ToUpper(level) {
+	case "", "1", "2", "3", "ERROR", "WARN", "WARNING", "INFO":
+		return true
+	}
+	return false
+}
+
+//validateShared checks the options that apply to the whole program rather than a single job
+func (c *Config) validateShared(p *problems) {
+	if !ValidLogLevel(c.LogLevel) {
+		p.add("logLevel", "%q must be 1, 2, 3, error, warn or info", c.LogLevel)
+	}
+
+	for _, job := range c.JobConfigs() {
+		if job.Backend == "" || job.Backend == DriveBackend {
+			requireFile(p, "credentialsPath", c.CredentialsPath)
+			requireParentDir(p, "tokenPath", c.TokenPath)
+			break
+		}
+	}
+	requireParentDir(p, "journalPath", c.JournalPath)
+
+	if c.RetryMaxAttempts < 0 {
+		p.add("retryMaxAttempts", "must not be negative")
+	}
+	for field, value := range map[string]string{
+		"retryBaseDelay":     c.RetryBaseDelay,
+		"retryMaxDelay":      c.RetryMaxDelay,
+		"retryMaxTotalDelay": c.RetryMaxTotalDelay,
+	} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(value); err != nil {
+			p.add(field, "%s", err.Error())
+		}
+	}
+	for field, value := range map[string]int{
+		"readLimitPerMinute":  c.ReadLimitPerMinute,
+		"readBurst":           c.ReadBurst,
+		"writeLimitPerMinute": c.WriteLimitPerMinute,
+		"writeBurst":          c.WriteBurst,
+		"updateWorkers":       c.UpdateWorkers,
+	} {
+		if value < 0 {
+			p.add(field, "must not be negative")
+		}
+	}
+}
+
+//validateJob checks the options that can differ between jobs, prefixing fields with prefix
+func (c *Config) validateJob(p *problems, prefix string) {
+	for i, spec := range c.CronSchedules {
+		if _, err := cron.ParseStandard(spec); err != nil {
+			p.add(fmt.Sprintf("%scronSchedules[%d]", prefix, i), "%q is not a valid cron expression: %s", spec, err.Error())
+		}
+	}
+
+	if strings.TrimSpace(c.ParentDirID) == "" {
+		p.add(prefix+"parentDirID", "is required")
+	}
+	if c.RunTimeout != "" {
+		if timeout, err := time.ParseDuration(c.RunTimeout); err != nil {
+			p.add(prefix+"runTimeout", "%s", err.Error())
+		} else if timeout <= 0 {
+			p.add(prefix+"runTimeout", "must be positive")
+		}
+	}
+	if utf8.RuneCountInString(c.NameDelimiter) > 1 {
+		p.add(prefix+"nameDelimiter", "%q must be a single character", c.NameDelimiter)
+	}
+	if len(c.FileExtensions) == 0 {
+		p.add(prefix+"fileExtensions", "at least one extension is required")
+	}
+	for i, word := range c.PersistentWords {
+		if strings.TrimSpace(word) == "" {
+			p.add(fmt.Sprintf("%spersistentWords[%d]", prefix, i), "is empty")
+		}
+	}
+
+	switch c.Backend {
+	case "", DriveBackend:
+		requireParentDir(p, prefix+"changesStatePath", c.ChangesStatePath)
+	case LocalBackend:
+		if c.ParentDirID != "" {
+			if info, err := os.Stat(c.ParentDirID); err != nil {
+				p.add(prefix+"parentDirID", "%s", err.Error())
+			} else if !info.IsDir() {
+				p.add(prefix+"parentDirID", "%s is not a directory", c.ParentDirID)
+			}
+		}
+		requireParentDir(p, prefix+"localStatePath", c.LocalStatePath)
+		if c.DestinationFolderID != "" {
+			if info, err := os.Stat(c.DestinationFolderID); err != nil {
+				p.add(prefix+"destinationFolderID", "%s", err.Error())
+			} else if !info.IsDir() {
+				p.add(prefix+"destinationFolderID", "%s is not a directory", c.DestinationFolderID)
+			}
+		}
+	default:
+		p.add(prefix+"backend", "%q must be %s or %s", c.Backend, DriveBackend, LocalBackend)
+	}
+	requireParentDir(p, prefix+"planOutput", c.PlanOutput)
+
+	for i, source := range c.DateSources {
+		field := fmt.Sprintf("%sdateSources[%d]", prefix, i)
+		switch {
+		case !contains(knownDateSources, source):
+			p.add(field, "%q must be one of %s", source, strings.Join(knownDateSources, ", "))
+		case source == "video" && c.Backend != LocalBackend:
+			p.add(field, "%q is only read by the local backend, drive doesn't keep the creation time of videos", source)
+		}
+	}
+	for word, aliases := range c.PersistentWordAliases {
+		field := fmt.Sprintf("%spersistentWordAliases.%s", prefix, word)
+		if !contains(c.PersistentWords, word) {
+			p.add(field, "%q isn't one of persistentWords", word)
+		}
+		for _, alias := range aliases {
+			if strings.TrimSpace(alias) == "" {
+				p.add(field, "has an empty alias")
+			}
+		}
+	}
+	if c.FuzzyMatchDistance < 0 {
+		p.add(prefix+"fuzzyMatchDistance", "must not be negative")
+	}
+	if c.StemMaxLength < 0 {
+		p.add(prefix+"stemMaxLength", "must not be negative")
+	}
+	switch c.SanitizeProfile {
+	case "", ProfilePosix, ProfileWindows, ProfileMacOS, ProfilePortable:
+	default:
+		p.add(prefix+"sanitizeProfile", "%q must be %s, %s, %s or %s", c.SanitizeProfile, ProfilePosix, ProfileWindows, ProfileMacOS, ProfilePortable)
+	}
+	if c.MaxNameLength < 0 {
+		p.add(prefix+"maxNameLength", "must not be negative")
+	}
+	switch c.CounterScope {
+	case "", CounterScopeName, CounterScopeDay, CounterScopeWords, CounterScopeGlobal:
+	default:
+		p.add(prefix+"counterScope", "%q must be %s, %s, %s or %s", c.CounterScope, CounterScopeName, CounterScopeDay, CounterScopeWords, CounterScopeGlobal)
+	}
+	if c.CounterStart < 0 {
+		p.add(prefix+"counterStart", "must not be negative")
+	}
+	switch c.CollisionScope {
+	case "", CollisionScopeTree, CollisionScopeFolder:
+	default:
+		p.add(prefix+"collisionScope", "%q must be %s or %s", c.CollisionScope, CollisionScopeTree, CollisionScopeFolder)
+	}
+	switch c.CollisionStrategy {
+	case "", CollisionBump, CollisionSkip, CollisionFail, CollisionIgnore:
+	default:
+		p.add(prefix+"collisionStrategy", "%q must be %s, %s, %s or %s", c.CollisionStrategy, CollisionBump, CollisionSkip, CollisionFail, CollisionIgnore)
+	}
+	c.validateDuplicates(p, prefix)
+	for i, rule := range c.RenameRules {
+		rule.validate(p, fmt.Sprintf("%srenameRules[%d].", prefix, i))
+	}
+}
+
+//validateDuplicates checks the duplicate policy and the quarantine folder it needs
+func (c *Config) validateDuplicates(p *problems, prefix string) {
+	switch c.DuplicatePolicy {
+	case "", DuplicateRename, DuplicateTag:
+	case DuplicateQuarantine:
+		if strings.TrimSpace(c.QuarantineFolderID) == "" {
+			p.add(prefix+"quarantineFolderID", "is required when duplicatePolicy is %s", DuplicateQuarantine)
+		} else if c.Backend != LocalBackend {
+			//drive ids can't say whether one folder is under another, the retriever leaves the quarantine out of the tree instead
+			if c.QuarantineFolderID == c.ParentDirID || c.QuarantineFolderID == c.DestinationFolderID {
+				p.add(prefix+"quarantineFolderID", "%s must not be parentDirID or destinationFolderID", c.QuarantineFolderID)
+			}
+		} else if c.ParentDirID != "" {
+			//a quarantine inside the tree would be scanned, and quarantined, again on every run
+			if isWithin(c.QuarantineFolderID, c.ParentDirID) {
+				p.add(prefix+"quarantineFolderID", "%s must be outside parentDirID", c.QuarantineFolderID)
+			} else if c.DestinationFolderID != "" && isWithin(c.QuarantineFolderID, c.DestinationFolderID) {
+				p.add(prefix+"quarantineFolderID", "%s must be outside destinationFolderID", c.QuarantineFolderID)
+			}
+		}
+	case DuplicateTrash:
+		if c.Backend == LocalBackend {
+			p.add(prefix+"duplicatePolicy", "%s is only supported by the %s backend", DuplicateTrash, DriveBackend)
+		}
+	default:
+		p.add(prefix+"duplicatePolicy", "%q must be %s, %s, %s or %s", c.DuplicatePolicy, DuplicateRename, DuplicateTag, DuplicateQuarantine, DuplicateTrash)
+	}
+}
+
+//isWithin returns true when path is dir or somewhere under it
+func isWithin(path string, dir string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+//groupReference finds the ${name} and $name references in a rename rule output
+var groupReference = regexp.MustCompile(`\$\{?(\w+)\}?`)
+
+func (r *RenameRule) validate(p *problems, prefix string) {
+	switch r.Case {
+	case "", CaseLower, CaseUpper, CaseTitle:
+	default:
+		p.add(prefix+"case", "%q must be %s, %s or %s", r.Case, CaseLower, CaseUpper, CaseTitle)
+	}
+	if r.Pattern == "" {
+		p.add(prefix+"pattern", "is required")
+		return
+	}
+	pattern, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		p.add(prefix+"pattern", "%s", err.Error())
+		return
+	}
+	for _, reference := range groupReference.FindAllStringSubmatch(r.Output, -1) {
+		name := reference[1]
+		if _, err := strconv.Atoi(name); err == nil {
+			continue
+		}
+		if !contains(pattern.SubexpNames(), name) {
+			p.add(prefix+"output", "refers to ${%s}, which isn't a named group in pattern", name)
+		}
+	}
+}
+
+//requireFile adds a problem if path isn't set or isn't a readable file
+func requireFile(p *problems, field string, path string) {
+	if path == "" {
+		p.add(field, "is required")
+		return
+	}
+	if info, err := os.Stat(path); err != nil {
+		p.add(field, "%s", err.Error())
+	} else if info.IsDir() {
+		p.add(field, "%s is a directory", path)
+	}
+}
+
+//requireParentDir adds a problem if path is set and the directory it would be written to doesn't exist
+func requireParentDir(p *problems, field string, path string) {
+	if path == "" {
+		return
+	}
+	if _, err := os.Stat(filepath.Dir(path)); err != nil {
+		p.add(field, "directory of %s does not exist", path)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
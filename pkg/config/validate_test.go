@@ -0,0 +1,140 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Validation", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "config")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("LoadConfig()", func() {
+		write := func(contents string) string {
+			path := filepath.Join(dir, "config.json")
+			Expect(ioutil.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+			return path
+		}
+
+		It("should report every problem at once", func() {
+			path := write(`{
+				"backend": "local",
+				"parentDirID": "` + dir + `",
+				"cronSchedule": ["0 * * * *"],
+				"cronSchedules": ["0 * * * *", "61 * * * *"],
+				"nameDelimiter": "--",
+				"fileExtensions": ["mp4"],
+				"retryMaxAttempts": "three"
+			}`)
+			_, err := LoadConfig(path)
+			Expect(fields(err)).To(Equal([]string{"cronSchedule", "cronSchedules[1]", "nameDelimiter", "retryMaxAttempts"}))
+		})
+
+		It("should report every value of the wrong type", func() {
+			path := write(`{
+				"backend": "local",
+				"parentDirID": "` + dir + `",
+				"fileExtensions": "mp4",
+				"RunAtLaunch": "yes",
+				"readLimitPerMinute": "many",
+				"jobs": [{"name": "footage", "fileExtensions": ["mov"], "dryRun": 1, "counterStart": "one"}]
+			}`)
+			_, err := LoadConfig(path)
+			Expect(fields(err)).To(Equal([]string{"RunAtLaunch", "fileExtensions", "jobs[0].counterStart", "jobs[0].dryRun", "readLimitPerMinute"}))
+		})
+
+		It("should normalize file extensions", func() {
+			path := write(`{"backend": "local", "parentDirID": "` + dir + `", "fileExtensions": [".MP4", "mp4", " .Mov"]}`)
+			cfg, err := LoadConfig(path)
+			Expect(err).To(BeNil())
+			Expect(cfg.FileExtensions).To(Equal([]string{"mp4", "mov"}))
+		})
+	})
+
+	Describe("Validate()", func() {
+		It("should require the options each backend needs", func() {
+			err := (&Config{Backend: DriveBackend, FileExtensions: []string{"mp4"}}).Validate()
+			Expect(fields(err)).To(Equal([]string{"credentialsPath", "parentDirID"}))
+
+			err = (&Config{Backend: LocalBackend, ParentDirID: filepath.Join(dir, "missing"), FileExtensions: []string{"mp4"}}).Validate()
+			Expect(fields(err)).To(Equal([]string{"parentDirID"}))
+		})
+
+		It("should reject unknown date sources and negative limits", func() {
+			cfg := &Config{
+				Backend:        LocalBackend,
+				ParentDirID:    dir,
+				FileExtensions: []string{"mp4"},
+				DateSources:    []string{"exif", "filename"},
+				ReadBurst:      -1,
+			}
+			Expect(fields(cfg.Validate())).To(Equal([]string{"dateSources[1]", "readBurst"}))
+		})
+
+		It("should reject video dates on drive, which doesn't keep them", func() {
+			credentials := filepath.Join(dir, "credentials.json")
+			Expect(ioutil.WriteFile(credentials, []byte("{}"), 0644)).To(Succeed())
+			cfg := &Config{
+				CredentialsPath: credentials,
+				ParentDirID:     "folder",
+				FileExtensions:  []string{"mp4"},
+				DateSources:     []string{"exif", "video", "createdDate"},
+			}
+			Expect(fields(cfg.Validate())).To(Equal([]string{"dateSources[1]"}))
+		})
+
+		It("should check the collision and duplicate options", func() {
+			cfg := &Config{
+				Backend:           LocalBackend,
+				ParentDirID:       dir,
+				FileExtensions:    []string{"mp4"},
+				CollisionScope:    "drive",
+				CollisionStrategy: "overwrite",
+				DuplicatePolicy:   DuplicateQuarantine,
+			}
+			Expect(fields(cfg.Validate())).To(Equal([]string{"collisionScope", "collisionStrategy", "quarantineFolderID"}))
+
+			cfg = &Config{Backend: LocalBackend, ParentDirID: dir, FileExtensions: []string{"mp4"}, DuplicatePolicy: DuplicateQuarantine, QuarantineFolderID: filepath.Join(dir, "dups")}
+			Expect(fields(cfg.Validate())).To(Equal([]string{"quarantineFolderID"}))
+
+			cfg.DuplicatePolicy = DuplicateTrash
+			Expect(fields(cfg.Validate())).To(Equal([]string{"duplicatePolicy"}))
+
+			credentials := filepath.Join(dir, "credentials.json")
+			Expect(ioutil.WriteFile(credentials, []byte("{}"), 0644)).To(Succeed())
+			cfg = &Config{
+				ParentDirID:        "inbox",
+				FileExtensions:     []string{"mp4"},
+				CredentialsPath:    credentials,
+				TokenPath:          filepath.Join(dir, "token.json"),
+				DuplicatePolicy:    DuplicateQuarantine,
+				QuarantineFolderID: "inbox",
+			}
+			Expect(fields(cfg.Validate())).To(Equal([]string{"quarantineFolderID"}))
+		})
+	})
+})
+
+//fields returns the field of every problem in a ValidationError
+func fields(err error) []string {
+	validationErr, ok := err.(*ValidationError)
+	Expect(ok).To(BeTrue(), "expected a ValidationError, got %v", err)
+	var found []string
+	for _, problem := range validationErr.Problems {
+		found = append(found, problem.Field)
+	}
+	return found
+}
@@ -0,0 +1,132 @@
+package fileactions
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//minFuzzyLength is the shortest word matched fuzzily. Shorter words are too close to
+//too many other words, "art" is one edit from "at", "cart" and "arts"
+const minFuzzyLength = 4
+
+//wordMatch is a persistent word found in a file name
+type wordMatch struct {
+	word string
+	//matchedBy is the alias or fuzzy match that found the word, empty if the word itself was found
+	matchedBy string
+}
+
+//matchPersistentWords returns the persistent words found in name, in config order.
+//A word is found if it or one of its aliases is in the name, ignoring case, or if
+//fuzzy matching is on and a word of the name is within the configured edit distance
+func (r *Renamer) matchPersistentWords(name string) []wordMatch {
+	lowerName := strings.ToLower(name)
+	var tokens []string
+	if r.config.FuzzyMatchDistance > 0 {
+		tokens = nameTokens(lowerName)
+	}
+
+	var matches []wordMatch
+	for _, word := range r.config.PersistentWords {
+		if strings.Contains(lowerName, strings.ToLower(word)) {
+			matches = append(matches, wordMatch{word: word})
+			continue
+		}
+		aliases := r.config.PersistentWordAliases[word]
+		if alias, ok := matchAlias(lowerName, aliases); ok {
+			matches = append(matches, wordMatch{word: word, matchedBy: alias})
+			continue
+		}
+		if token, ok := matchFuzzy(tokens, append([]string{word}, aliases...), r.config.FuzzyMatchDistance); ok {
+			matches = append(matches, wordMatch{word: word, matchedBy: token})
+		}
+	}
+	return matches
+}
+
+//matchAlias returns the first alias found in lowerName, ignoring case
+func matchAlias(lowerName string, aliases []string) (string, bool) {
+	for _, alias := range aliases {
+		if alias != "" && strings.Contains(lowerName, strings.ToLower(alias)) {
+			return alias, true
+		}
+	}
+	return "", false
+}
+
+//matchFuzzy returns the first token within distance edits of one of the candidates
+func matchFuzzy(tokens []string, candidates []string, distance int) (string, bool) {
+	for _, candidate := range candidates {
+		candidate = strings.ToLower(candidate)
+		if len([]rune(candidate)) < minFuzzyLength {
+			continue
+		}
+		for _, token := range tokens {
+			if len([]rune(token)) >= minFuzzyLength && editDistance(token, candidate) <= distance {
+				return token, true
+			}
+		}
+	}
+	return "", false
+}
+
+//nameTokens splits a file name, without its extension, into its words
+func nameTokens(name string) []string {
+	if i := strings.LastIndex(name, "."); i != -1 {
+		name = name[:i]
+	}
+	return strings.FieldsFunc(name, func(r rune) bool {
+		return !isWordRune(r)
+	})
+}
+
+//editDistance returns the levenshtein distance between a and b
+func editDistance(a string, b string) int {
+	ar, br := []rune(a), []rune(b)
+	previous := make([]int, len(br)+1)
+	current := make([]int, len(br)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		current[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(br)]
+}
+
+func minInt(values ...int) int {
+	lowest := values[0]
+	for _, v := range values[1:] {
+		if v < lowest {
+			lowest = v
+		}
+	}
+	return lowest
+}
+
+//summarizeAliases lists how often each alias matched, most matched first
+func summarizeAliases(counts map[string]int) string {
+	matches := make([]string, 0, len(counts))
+	for match := range counts {
+		matches = append(matches, match)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if counts[matches[i]] != counts[matches[j]] {
+			return counts[matches[i]] > counts[matches[j]]
+		}
+		return matches[i] < matches[j]
+	})
+	for i, match := range matches {
+		matches[i] = fmt.Sprintf("%s x%d", match, counts[match])
+	}
+	return strings.Join(matches, ", ")
+}
@@ -0,0 +1,44 @@
+package fileactions
+
+import (
+	"github.com/davidparks11/file-renamer/pkg/config"
+	"github.com/davidparks11/file-renamer/pkg/logger"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Persistent word aliases", func() {
+	renamer := NewProcess(&logger.MockLogger{}, nil, nil, &config.Config{
+		PersistentWords: []string{"landscape", "work", "art"},
+		PersistentWordAliases: map[string][]string{
+			"landscape": {"lndscp", "land-scape"},
+		},
+		FuzzyMatchDistance: 1,
+	}).(*Renamer)
+
+	It("should map aliases to the persistent word and report the alias", func() {
+		Expect(renamer.matchPersistentWords("Land-Scape_work.png")).To(Equal([]wordMatch{
+			{word: "landscape", matchedBy: "land-scape"},
+			{word: "work"},
+		}))
+		Expect(renamer.matchPersistentWords("LNDSCP.png")).To(Equal([]wordMatch{{word: "landscape", matchedBy: "lndscp"}}))
+	})
+
+	It("should match whole words within the edit distance", func() {
+		Expect(renamer.matchPersistentWords("lanscape wrk.png")).To(Equal([]wordMatch{{word: "landscape", matchedBy: "lanscape"}}))
+		Expect(renamer.matchPersistentWords("ndscp.png")).To(Equal([]wordMatch{{word: "landscape", matchedBy: "ndscp"}}))
+		Expect(renamer.matchPersistentWords("at.png")).To(BeEmpty())
+	})
+
+	It("should show aliases in the plan", func() {
+		entry := &PlanEntry{MatchedWords: []string{"landscape", "work"}, MatchedAliases: map[string]string{"landscape": "lndscp"}}
+		Expect(entry.columns()[3]).To(Equal("landscape(lndscp),work"))
+	})
+
+	It("should measure edit distance", func() {
+		Expect(editDistance("landscape", "lanscape")).To(Equal(1))
+		Expect(editDistance("kitten", "sitting")).To(Equal(3))
+		Expect(editDistance("", "abc")).To(Equal(3))
+	})
+})
@@ -0,0 +1,214 @@
+package fileactions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
+)
+
+const (
+	//checkpointSaveEvery is how many changes are marked done before the checkpoint is saved
+	checkpointSaveEvery = 50
+	//checkpointSaveInterval is the longest a change marked done waits to be saved
+	checkpointSaveInterval = 5 * time.Second
+)
+
+//checkpoint is the plan of a run and how far the run got. It's kept on disk until every
+//change is made, so a run that dies partway is resumed with the same names
+type checkpoint struct {
+	RunID string `json:"runID"`
+	Job   string `json:"job,omitempty"`
+	//ParentDirID is the folder the plan was made for, the checkpoint is thrown away if it changes
+	ParentDirID string             `json:"parentDirID"`
+	Entries     []*checkpointEntry `json:"entries"`
+
+	path string
+	mu   sync.Mutex
+	//byEntry finds the checkpoint entry of a plan entry
+	byEntry map[*PlanEntry]*checkpointEntry
+	//unsaved counts the changes marked done since the last save
+	unsaved int
+	savedAt time.Time
+}
+
+//checkpointEntry is a planned change along with what's needed to make it after a restart
+type checkpointEntry struct {
+	*PlanEntry
+	//Folders holds the name of each folder on the path the file is moved to
+	Folders []string `json:"folders,omitempty"`
+	//Lead is the id of the file this file is renamed along with, when they share a stem
+	Lead string `json:"lead,omitempty"`
+	Done bool   `json:"done,omitempty"`
+}
+
+//newCheckpoint makes the checkpoint of a plan that's about to be applied
+func (r *Renamer) newCheckpoint(runID string, plan []*PlanEntry) *checkpoint {
+	c := &checkpoint{
+		RunID:       runID,
+		Job:         r.config.Name,
+		ParentDirID: r.config.ParentDirID,
+		path:        r.config.CheckpointPath,
+		byEntry:     make(map[*PlanEntry]*checkpointEntry),
+	}
+	for _, entry := range plan {
+		c.add(&checkpointEntry{PlanEntry: entry, Folders: entry.folders})
+	}
+	//paired files come after their lead in the plan, so leads are set once every entry is added
+	for _, entry := range plan {
+		for _, paired := range entry.paired {
+			c.byEntry[paired].Lead = entry.ID
+		}
+	}
+	return c
+}
+
+func (c *checkpoint) add(entry *checkpointEntry) {
+	c.Entries = append(c.Entries, entry)
+	c.byEntry[entry.PlanEntry] = entry
+}
+
+//loadCheckpoint reads the checkpoint of a run that didn't finish. It returns nil if
+//there isn't one, or it was made for another job or folder
+func (r *Renamer) loadCheckpoint() (*checkpoint, error) {
+	b, err := ioutil.ReadFile(r.config.CheckpointPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &checkpoint{}
+	if err = json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("%s: %s", r.config.CheckpointPath, err.Error())
+	}
+	if c.Job != r.config.Name || c.ParentDirID != r.config.ParentDirID {
+		r.logger.Warn(fmt.Sprintf("Ignoring checkpoint of run %s, it was made for another job or parentDirID", c.RunID))
+		return nil, nil
+	}
+	c.path = r.config.CheckpointPath
+	c.byEntry = make(map[*PlanEntry]*checkpointEntry)
+	for _, entry := range c.Entries {
+		c.byEntry[entry.PlanEntry] = entry
+	}
+	return c, nil
+}
+
+//save writes the checkpoint through a temp file so a crash can't truncate it
+func (c *checkpoint) save() error {
+	b, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(c.path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(c.path+".tmp", c.path); err != nil {
+		return err
+	}
+	c.unsaved = 0
+	c.savedAt = time.Now()
+	return nil
+}
+
+//remove deletes the checkpoint once every change in it is made
+func (c *checkpoint) remove() error {
+	err := os.Remove(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+//markDone records that the change of entry was made, so it's skipped if the run is resumed.
+//The checkpoint is saved in batches rather than per file. A change made but not saved as
+//done is still skipped on resume, since the file is no longer listed as unprocessed
+func (r *Renamer) markDone(entry *PlanEntry) {
+	c := r.checkpoint
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if saved, ok := c.byEntry[entry]; ok {
+		saved.Done = true
+		c.unsaved++
+	}
+	if c.unsaved < checkpointSaveEvery && time.Since(c.savedAt) < checkpointSaveInterval {
+		return
+	}
+	if err := c.save(); err != nil {
+		r.logger.Error("Unable to save checkpoint: " + err.Error())
+	}
+}
+
+//finishCheckpoint removes the checkpoint after the plan was applied, or keeps it when
+//the run was stopped so the next run picks up where this one left off
+func (r *Renamer) finishCheckpoint(stopped bool) {
+	c := r.checkpoint
+	r.checkpoint = nil
+	if c == nil {
+		return
+	}
+	if stopped {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.unsaved > 0 {
+			if err := c.save(); err != nil {
+				r.logger.Error("Unable to save checkpoint: " + err.Error())
+			}
+		}
+		r.logger.Info(fmt.Sprintf("Progress of run %s is kept in %s, the next run resumes it", c.RunID, c.path))
+		return
+	}
+	if err := c.remove(); err != nil {
+		r.logger.Error("Unable to remove checkpoint: " + err.Error())
+	}
+}
+
+//resume makes the changes left in the checkpoint of a run that didn't finish, with the
+//names it planned. files are the unprocessed files, so a planned file missing from them
+//was updated before the run stopped, or has gone since
+func (r *Renamer) resume(ctx context.Context, c *checkpoint, files []*fileretrieveriface.RenameInfo) error {
+	byID := make(map[string]*fileretrieveriface.RenameInfo, len(files))
+	for _, file := range files {
+		byID[file.ID] = file
+	}
+
+	var plan []*PlanEntry
+	leads := make(map[string]*PlanEntry)
+	for _, saved := range c.Entries {
+		file, ok := byID[saved.ID]
+		if saved.Done || !ok {
+			saved.Done = true
+			continue
+		}
+		entry := saved.PlanEntry
+		entry.file = file
+		entry.folders = saved.Folders
+		file.DateSource = entry.DateSource
+		if lead, ok := leads[saved.Lead]; ok && saved.Lead != "" {
+			lead.paired = append(lead.paired, entry)
+		} else {
+			//its lead was renamed before the run stopped, so it's renamed on its own
+			entry.PairedWith = ""
+			leads[entry.ID] = entry
+		}
+		plan = append(plan, entry)
+	}
+	r.logger.Info(fmt.Sprintf("Resuming run %s, %d of %d planned changes are left", c.RunID, len(plan), len(c.Entries)))
+	if err := c.save(); err != nil {
+		r.logger.Error("Unable to save checkpoint: " + err.Error())
+	}
+
+	r.folders = make(map[string]string)
+	r.checkpoint = c
+	err := r.applyPlan(ctx, c.RunID, plan)
+	r.finishCheckpoint(err != nil)
+	return err
+}
@@ -0,0 +1,147 @@
+package fileactions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/davidparks11/file-renamer/pkg/config"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
+	"github.com/davidparks11/file-renamer/pkg/logger"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = Describe("Checkpoints", func() {
+	var (
+		dir string
+		cfg *config.Config
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "checkpoint")
+		Expect(err).To(BeNil())
+		cfg = &config.Config{
+			PersistentWords: []string{"foo"},
+			NameDelimiter:   "_",
+			ParentDirID:     "inbox",
+			CheckpointPath:  filepath.Join(dir, "checkpoint.json"),
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should resume a stopped run with the names it planned", func() {
+		files := []*fileretrieveriface.RenameInfo{
+			{ID: "a", Name: "foo.mov", CreatedDate: "2020-08-31T19:00:00Z"},
+			{ID: "b", Name: "foo.mov", CreatedDate: "2020-08-31T20:00:00Z"},
+			{ID: "c", Name: "foo.mov", CreatedDate: "2020-08-31T21:00:00Z"},
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		first := &fileretriever.MockFileRetriever{}
+		first.On("GetFileInfo").Return(files, nil)
+		first.On("GetExistingFiles").Return(files, nil)
+		first.On("GetProcessedFiles").Return(map[string]bool{})
+		first.On("UpdateFile", mock.Anything).Run(func(mock.Arguments) { cancel() }).Return(nil)
+		Expect(NewProcess(&logger.MockLogger{}, first, nil, cfg).Run(ctx)).NotTo(Succeed())
+		Expect(cfg.CheckpointPath).To(BeAnExistingFile())
+
+		//a file listed before the others would take their numbers if the plan was made again
+		earlier := &fileretrieveriface.RenameInfo{ID: "z", Name: "foo.mov", CreatedDate: "2020-08-31T08:00:00Z"}
+		left := []*fileretrieveriface.RenameInfo{earlier, files[1], files[2]}
+		second := &fileretriever.MockFileRetriever{}
+		second.On("GetFileInfo").Return(left, nil)
+		second.On("UpdateFile", mock.Anything).Return(nil)
+		Expect(NewProcess(&logger.MockLogger{}, second, nil, cfg).Run(context.Background())).To(Succeed())
+
+		Expect(files[1].Name).To(Equal("foo_2020_0831_1.mov"))
+		Expect(files[2].Name).To(Equal("foo_2020_0831_2.mov"))
+		Expect(earlier.Name).To(Equal("foo.mov"))
+		second.AssertNumberOfCalls(GinkgoT(), "UpdateFile", 2)
+		Expect(cfg.CheckpointPath).NotTo(BeAnExistingFile())
+	})
+
+	It("should save progress in batches and once more when the run stops", func() {
+		var plan []*PlanEntry
+		for i := 0; i < checkpointSaveEvery+1; i++ {
+			plan = append(plan, &PlanEntry{ID: fmt.Sprint(i), NewName: fmt.Sprintf("foo_%d.mov", i)})
+		}
+		r := NewProcess(&logger.MockLogger{}, nil, nil, cfg).(*Renamer)
+		r.checkpoint = r.newCheckpoint("run", plan)
+		Expect(r.checkpoint.save()).To(Succeed())
+
+		//done counts the changes marked done in the checkpoint on disk
+		done := func() int {
+			b, err := ioutil.ReadFile(cfg.CheckpointPath)
+			Expect(err).To(BeNil())
+			saved := &checkpoint{}
+			Expect(json.Unmarshal(b, saved)).To(Succeed())
+			count := 0
+			for _, entry := range saved.Entries {
+				if entry.Done {
+					count++
+				}
+			}
+			return count
+		}
+
+		for _, entry := range plan[:checkpointSaveEvery-1] {
+			r.markDone(entry)
+		}
+		Expect(done()).To(Equal(0))
+		r.markDone(plan[checkpointSaveEvery-1])
+		Expect(done()).To(Equal(checkpointSaveEvery))
+
+		r.markDone(plan[checkpointSaveEvery])
+		Expect(done()).To(Equal(checkpointSaveEvery))
+		r.finishCheckpoint(true)
+		Expect(done()).To(Equal(checkpointSaveEvery + 1))
+	})
+
+	It("should checkpoint files paired by stem along with their lead", func() {
+		cfg.PairByStem = true
+		files := []*fileretrieveriface.RenameInfo{
+			{ID: "a", Name: "foo.jpg", CreatedDate: "2020-08-31T19:00:00Z"},
+			{ID: "b", Name: "foo.cr2", CreatedDate: "2020-08-31T19:00:01Z"},
+		}
+		r := NewProcess(&logger.MockLogger{}, nil, nil, cfg).(*Renamer)
+		lead := &PlanEntry{ID: "a", NewName: "foo_2020_0831_0.jpg"}
+		paired := &PlanEntry{ID: "b", NewName: "foo_2020_0831_0.cr2", PairedWith: files[0].Name}
+		lead.paired = []*PlanEntry{paired}
+		c := r.newCheckpoint("run", []*PlanEntry{lead, paired})
+		Expect(c.byEntry[lead].Lead).To(BeEmpty())
+		Expect(c.byEntry[paired].Lead).To(Equal("a"))
+
+		mockRetriever := &fileretriever.MockFileRetriever{}
+		mockRetriever.On("GetFileInfo").Return(files, nil)
+		mockRetriever.On("GetExistingFiles").Return(files, nil)
+		mockRetriever.On("GetProcessedFiles").Return(map[string]bool{})
+		mockRetriever.On("UpdateFile", mock.Anything).Return(nil)
+
+		Expect(NewProcess(&logger.MockLogger{}, mockRetriever, nil, cfg).Run(context.Background())).To(Succeed())
+		Expect(files[0].Name).To(Equal("foo_2020_0831_0.jpg"))
+		Expect(files[1].Name).To(Equal("foo_2020_0831_0.cr2"))
+		Expect(cfg.CheckpointPath).NotTo(BeAnExistingFile())
+	})
+
+	It("should not keep a checkpoint once the plan is applied", func() {
+		files := []*fileretrieveriface.RenameInfo{{ID: "a", Name: "foo.mov", CreatedDate: "2020-08-31T19:00:00Z"}}
+		mockRetriever := &fileretriever.MockFileRetriever{}
+		mockRetriever.On("GetFileInfo").Return(files, nil)
+		mockRetriever.On("GetExistingFiles").Return(files, nil)
+		mockRetriever.On("GetProcessedFiles").Return(map[string]bool{})
+		mockRetriever.On("UpdateFile", mock.Anything).Return(nil)
+
+		Expect(NewProcess(&logger.MockLogger{}, mockRetriever, nil, cfg).Run(context.Background())).To(Succeed())
+		Expect(cfg.CheckpointPath).NotTo(BeAnExistingFile())
+	})
+})
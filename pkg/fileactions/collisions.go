@@ -0,0 +1,63 @@
+package fileactions
+
+import (
+	"fmt"
+
+	"github.com/davidparks11/file-renamer/pkg/config"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
+)
+
+//nameTakenError is returned when a new name is held by a file the run doesn't rename
+type nameTakenError struct {
+	name string
+}
+
+func (e *nameTakenError) Error() string {
+	return fmt.Sprintf("%s is already taken by another file", e.name)
+}
+
+//loadTakenNames records the names of the existing files, so new names can't collide
+//with them. Files of the run hold on to their names too, since a file may not be
+//renamed, or not be renamed before another file takes its name
+func (r *Renamer) loadTakenNames(existing []*fileretrieveriface.RenameInfo) {
+	r.taken = make(map[string]map[string]string)
+	for _, file := range existing {
+		folder := r.collisionFolder(file)
+		if r.taken[folder] == nil {
+			r.taken[folder] = make(map[string]string)
+		}
+		r.taken[folder][file.Name] = file.ID
+	}
+}
+
+//collisionFolder returns the key of the names a file's new name must not collide with.
+//With the default tree scope every file shares a key. So do files being moved, since
+//the folder they're moved to isn't known until it's found or created
+func (r *Renamer) collisionFolder(file *fileretrieveriface.RenameInfo) string {
+	if r.config.CollisionScope == config.CollisionScopeFolder && !r.movesFiles() {
+		return file.ParentID
+	}
+	return ""
+}
+
+//isTaken returns true when name belongs to an existing file other than file
+func (r *Renamer) isTaken(name string, file *fileretrieveriface.RenameInfo) bool {
+	holder, ok := r.taken[r.collisionFolder(file)][name]
+	return ok && holder != file.ID
+}
+
+//checksCollisions returns true when new names are checked against files the run
+//doesn't rename, which needs every file in the tree to be listed. It's on unless the
+//ignore strategy is set, or incremental sync is on and neither collision option is,
+//since listing the tree would cost every run what incremental sync saves
+func (r *Renamer) checksCollisions() bool {
+	if r.config.CollisionScope == "" && r.config.CollisionStrategy == "" {
+		return !r.config.IncrementalSync
+	}
+	return r.config.CollisionStrategy != config.CollisionIgnore
+}
+
+//bumpsCollisions returns true when a taken name is resolved by moving on to the next counter
+func (r *Renamer) bumpsCollisions() bool {
+	return r.config.CollisionStrategy == "" || r.config.CollisionStrategy == config.CollisionBump
+}
@@ -0,0 +1,194 @@
+package fileactions
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/davidparks11/file-renamer/pkg/config"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
+	"github.com/davidparks11/file-renamer/pkg/logger"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Collisions and duplicates", func() {
+	var dir string
+	var cfg *config.Config
+	var mockRetriever *fileretriever.MockFileRetriever
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "collisions")
+		Expect(err).To(BeNil())
+		cfg = &config.Config{
+			PersistentWords: []string{"foo"},
+			NameDelimiter:   "_",
+			DryRun:          true,
+			PlanFormat:      PlanFormatJSON,
+			PlanOutput:      filepath.Join(dir, "plan.json"),
+		}
+		mockRetriever = &fileretriever.MockFileRetriever{}
+		mockRetriever.On("GetProcessedFiles").Return(map[string]bool{})
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	//plan returns the plan entries of a dry run by file id. Every file to rename is
+	//also an existing file, like it is in drive
+	plan := func(files []*fileretrieveriface.RenameInfo, others ...*fileretrieveriface.RenameInfo) (map[string]*PlanEntry, error) {
+		mockRetriever.On("GetFileInfo").Return(files, nil)
+		mockRetriever.On("GetExistingFiles").Return(append(append([]*fileretrieveriface.RenameInfo{}, files...), others...), nil)
+		if err := NewProcess(&logger.MockLogger{}, mockRetriever, nil, cfg).Run(context.Background()); err != nil {
+			return nil, err
+		}
+
+		b, err := ioutil.ReadFile(cfg.PlanOutput)
+		Expect(err).To(BeNil())
+		var entries []*PlanEntry
+		Expect(json.Unmarshal(b, &entries)).To(Succeed())
+		byID := make(map[string]*PlanEntry)
+		for _, entry := range entries {
+			byID[entry.ID] = entry
+		}
+		return byID, nil
+	}
+
+	file := func(id string, parent string, md5 string) *fileretrieveriface.RenameInfo {
+		return &fileretrieveriface.RenameInfo{ID: id, Name: "foo.mov", CreatedDate: "2020-08-31T19:00:00Z", ParentID: parent, MD5Checksum: md5, Size: 10}
+	}
+	manual := &fileretrieveriface.RenameInfo{ID: "manual", Name: "foo_2020_0831_0.mov", ParentID: "one"}
+
+	Context("when an unprocessed file already has the new name", func() {
+		It("should bump the counter past it by default", func() {
+			entries, err := plan([]*fileretrieveriface.RenameInfo{file("a", "two", "")}, manual)
+			Expect(err).To(BeNil())
+			Expect(entries["a"].NewName).To(Equal("foo_2020_0831_1.mov"))
+		})
+
+		It("should not list the tree by default with incremental sync", func() {
+			cfg.IncrementalSync = true
+			entries, err := plan([]*fileretrieveriface.RenameInfo{file("a", "two", "")}, manual)
+			Expect(err).To(BeNil())
+			Expect(entries["a"].NewName).To(Equal("foo_2020_0831_0.mov"))
+			mockRetriever.AssertNotCalled(GinkgoT(), "GetExistingFiles")
+		})
+
+		It("should check collisions with incremental sync when a strategy is set", func() {
+			cfg.IncrementalSync = true
+			cfg.CollisionStrategy = config.CollisionBump
+			entries, err := plan([]*fileretrieveriface.RenameInfo{file("a", "two", "")}, manual)
+			Expect(err).To(BeNil())
+			Expect(entries["a"].NewName).To(Equal("foo_2020_0831_1.mov"))
+		})
+
+		It("should not list the tree with the ignore strategy and no duplicate policy", func() {
+			cfg.CollisionStrategy = config.CollisionIgnore
+			entries, err := plan([]*fileretrieveriface.RenameInfo{file("a", "two", "")}, manual)
+			Expect(err).To(BeNil())
+			Expect(entries["a"].NewName).To(Equal("foo_2020_0831_0.mov"))
+			mockRetriever.AssertNotCalled(GinkgoT(), "GetExistingFiles")
+		})
+
+		It("should only look in the same folder with the folder scope", func() {
+			cfg.CollisionScope = config.CollisionScopeFolder
+			entries, err := plan([]*fileretrieveriface.RenameInfo{file("a", "two", "")}, manual)
+			Expect(err).To(BeNil())
+			Expect(entries["a"].NewName).To(Equal("foo_2020_0831_0.mov"))
+		})
+
+		It("should leave the file alone with the skip strategy", func() {
+			cfg.CollisionStrategy = config.CollisionSkip
+			entries, err := plan([]*fileretrieveriface.RenameInfo{file("a", "two", "")}, manual)
+			Expect(err).To(BeNil())
+			Expect(entries).To(BeEmpty())
+		})
+
+		It("should fail the run with the fail strategy", func() {
+			cfg.CollisionStrategy = config.CollisionFail
+			_, err := plan([]*fileretrieveriface.RenameInfo{file("a", "two", "")}, manual)
+			Expect(err).To(MatchError(ContainSubstring("foo_2020_0831_0.mov is already taken")))
+		})
+
+		It("should let a file keep its own name without renaming it to itself", func() {
+			cfg.CollisionStrategy = config.CollisionFail
+			renamed := &fileretrieveriface.RenameInfo{ID: "a", Name: "foo_2020_0831_0.mov", CreatedDate: "2020-08-31T19:00:00Z"}
+			other := file("b", "", "")
+			entries, err := plan([]*fileretrieveriface.RenameInfo{renamed, other})
+			Expect(err).To(BeNil())
+			Expect(entries).NotTo(HaveKey("a"))
+			Expect(entries["b"].NewName).To(Equal("foo_2020_0831_1.mov"))
+		})
+	})
+
+	Context("when files have the same content", func() {
+		files := func() []*fileretrieveriface.RenameInfo {
+			return []*fileretrieveriface.RenameInfo{file("a", "one", "abc"), file("b", "one", "abc"), file("c", "one", "def")}
+		}
+
+		It("should find nothing without a duplicate policy", func() {
+			entries, err := plan(files())
+			Expect(err).To(BeNil())
+			Expect(entries["b"].DuplicateOf).To(BeEmpty())
+		})
+
+		It("should rename duplicates normally with the rename policy", func() {
+			cfg.DuplicatePolicy = config.DuplicateRename
+			entries, err := plan(files())
+			Expect(err).To(BeNil())
+			Expect(entries["a"].DuplicateOf).To(BeEmpty())
+			Expect(entries["b"].DuplicateOf).To(Equal("foo.mov"))
+			Expect(entries["b"].NewName).To(Equal("foo_2020_0831_1.mov"))
+			Expect(entries["c"].DuplicateOf).To(BeEmpty())
+		})
+
+		It("should mark duplicates with the tag policy", func() {
+			cfg.DuplicatePolicy = config.DuplicateTag
+			entries, err := plan(files())
+			Expect(err).To(BeNil())
+			Expect(entries["b"].NewName).To(Equal("foo_dup_2020_0831_0.mov"))
+		})
+
+		It("should keep a file already in the tree over the files of the run", func() {
+			cfg.DuplicatePolicy = config.DuplicateQuarantine
+			kept := &fileretrieveriface.RenameInfo{ID: "kept", Name: "foo_2020_0830_0.mov", MD5Checksum: "abc", Size: 10}
+			entries, err := plan(files(), kept)
+			Expect(err).To(BeNil())
+			Expect(entries["a"].Action).To(Equal(config.DuplicateQuarantine))
+			Expect(entries["a"].DuplicateOf).To(Equal("foo_2020_0830_0.mov"))
+			Expect(entries["b"].Action).To(Equal(config.DuplicateQuarantine))
+			Expect(entries["c"].NewName).To(Equal("foo_2020_0831_0.mov"))
+		})
+
+		It("should not match files of a different size", func() {
+			cfg.DuplicatePolicy = config.DuplicateTrash
+			other := file("b", "one", "abc")
+			other.Size = 11
+			entries, err := plan([]*fileretrieveriface.RenameInfo{file("a", "one", "abc"), other})
+			Expect(err).To(BeNil())
+			Expect(entries["b"].Action).To(BeEmpty())
+		})
+
+		It("should move duplicates when not a dry run", func() {
+			cfg.DryRun = false
+			cfg.DuplicatePolicy = config.DuplicateQuarantine
+			cfg.QuarantineFolderID = "quarantine"
+			run := files()
+			mockRetriever.On("GetFileInfo").Return(run, nil)
+			mockRetriever.On("GetExistingFiles").Return(run, nil)
+			mockRetriever.On("UpdateFile", run[0]).Return(nil)
+			mockRetriever.On("UpdateFile", run[2]).Return(nil)
+			mockRetriever.On("MoveFile", run[1], "quarantine").Return(nil)
+
+			Expect(NewProcess(&logger.MockLogger{}, mockRetriever, nil, cfg).Run(context.Background())).To(Succeed())
+			mockRetriever.AssertCalled(GinkgoT(), "MoveFile", run[1], "quarantine")
+			mockRetriever.AssertNumberOfCalls(GinkgoT(), "UpdateFile", 2)
+		})
+	})
+})
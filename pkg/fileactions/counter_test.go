@@ -0,0 +1,105 @@
+package fileactions
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/davidparks11/file-renamer/pkg/config"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
+	"github.com/davidparks11/file-renamer/pkg/logger"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Counters", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "counter")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	//plan returns the new name of each file id from a dry run
+	plan := func(cfg *config.Config, processed map[string]bool, files ...*fileretrieveriface.RenameInfo) map[string]string {
+		mockRetriever := &fileretriever.MockFileRetriever{}
+		mockRetriever.On("GetFileInfo").Return(files, nil)
+		mockRetriever.On("GetExistingFiles").Return(files, nil)
+		mockRetriever.On("GetProcessedFiles").Return(processed)
+
+		cfg.PersistentWords = []string{"foo", "bar"}
+		cfg.NameDelimiter = "_"
+		cfg.DryRun = true
+		cfg.PlanFormat = PlanFormatJSON
+		cfg.PlanOutput = filepath.Join(dir, "plan.json")
+		Expect(NewProcess(&logger.MockLogger{}, mockRetriever, nil, cfg).Run(context.Background())).To(Succeed())
+
+		b, err := ioutil.ReadFile(cfg.PlanOutput)
+		Expect(err).To(BeNil())
+		var entries []*PlanEntry
+		Expect(json.Unmarshal(b, &entries)).To(Succeed())
+		names := make(map[string]string)
+		for _, entry := range entries {
+			names[entry.ID] = entry.NewName
+		}
+		return names
+	}
+
+	It("should number files by capture time then id, whatever order they're listed in", func() {
+		names := plan(&config.Config{}, map[string]bool{},
+			&fileretrieveriface.RenameInfo{ID: "c", Name: "foo.mov", CreatedDate: "2020-08-31T19:00:00Z"},
+			&fileretrieveriface.RenameInfo{ID: "b", Name: "foo.mov", CreatedDate: "2020-08-31T08:00:00Z"},
+			&fileretrieveriface.RenameInfo{ID: "a", Name: "foo.mov", CreatedDate: "2020-08-31T19:00:00Z"},
+		)
+		Expect(names).To(Equal(map[string]string{
+			"b": "foo_2020_0831_0.mov",
+			"a": "foo_2020_0831_1.mov",
+			"c": "foo_2020_0831_2.mov",
+		}))
+	})
+
+	It("should share a counter per day from the start value, after the day's processed names", func() {
+		names := plan(&config.Config{CounterScope: config.CounterScopeDay, CounterStart: 1}, map[string]bool{"bar_2020_0831_2.mov": true},
+			&fileretrieveriface.RenameInfo{ID: "a", Name: "foo.mov", CreatedDate: "2020-08-31T08:00:00Z"},
+			&fileretrieveriface.RenameInfo{ID: "b", Name: "bar.mov", CreatedDate: "2020-08-31T09:00:00Z"},
+			&fileretrieveriface.RenameInfo{ID: "c", Name: "foo.mov", CreatedDate: "2020-08-31T10:00:00Z"},
+			&fileretrieveriface.RenameInfo{ID: "d", Name: "foo.mov", CreatedDate: "2020-09-01T10:00:00Z"},
+		)
+		Expect(names).To(Equal(map[string]string{
+			"a": "foo_2020_0831_3.mov",
+			"b": "bar_2020_0831_4.mov",
+			"c": "foo_2020_0831_5.mov",
+			"d": "foo_2020_0901_1.mov",
+		}))
+	})
+
+	It("should carry on counting a scope in the next run", func() {
+		cfg := &config.Config{CounterScope: config.CounterScopeGlobal, NameTemplate: "{words}{sep}{created:2006_0102}{sep}{counter:03}{ext}"}
+		first := plan(cfg, map[string]bool{},
+			&fileretrieveriface.RenameInfo{ID: "a", Name: "foo.mp4", CreatedDate: "2020-08-31T08:00:00Z"},
+			&fileretrieveriface.RenameInfo{ID: "b", Name: "bar.mov", CreatedDate: "2020-09-01T09:00:00Z"},
+		)
+		Expect(first).To(Equal(map[string]string{
+			"a": "foo_2020_0831_000.mp4",
+			"b": "bar_2020_0901_001.mov",
+		}))
+
+		processed := map[string]bool{"unrelated.mov": true}
+		for _, name := range first {
+			processed[name] = true
+		}
+		second := plan(cfg, processed,
+			&fileretrieveriface.RenameInfo{ID: "c", Name: "foo.mov", CreatedDate: "2020-09-02T10:00:00Z"},
+		)
+		Expect(second).To(Equal(map[string]string{"c": "foo_2020_0902_002.mov"}))
+	})
+})
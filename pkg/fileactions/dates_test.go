@@ -0,0 +1,36 @@
+package fileactions
+
+import (
+	"github.com/davidparks11/file-renamer/pkg/config"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("captureDate()", func() {
+	renamer := &Renamer{
+		config: &config.Config{
+			DateSources: []string{"exif", "imageMediaMetadata", "createdDate"},
+		},
+	}
+
+	It("should use the first source in the chain that has a date", func() {
+		file := &fileretrieveriface.RenameInfo{
+			CreatedDate: "2020-09-02T10:00:00Z",
+			Dates: map[string]string{
+				"imageMediaMetadata": "2020-08-31T19:33:44Z",
+				"createdDate":        "2020-09-02T10:00:00Z",
+			},
+		}
+		date, source, err := renamer.captureDate(file)
+		Expect(err).To(BeNil())
+		Expect(date).To(Equal("2020-08-31T19:33:44Z"))
+		Expect(source).To(Equal("imageMediaMetadata"))
+	})
+
+	It("should fail when no source in the chain has a date", func() {
+		_, _, err := (&Renamer{config: &config.Config{DateSources: []string{"exif"}}}).
+			captureDate(&fileretrieveriface.RenameInfo{CreatedDate: "2020-09-02T10:00:00Z"})
+		Expect(err).NotTo(BeNil())
+	})
+})
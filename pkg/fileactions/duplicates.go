@@ -0,0 +1,92 @@
+package fileactions
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/davidparks11/file-renamer/pkg/config"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
+)
+
+//duplicateMarker is added after the words of duplicates when duplicatePolicy is tag
+const duplicateMarker = "dup"
+
+//duplicateGroup is a set of files with the same content
+type duplicateGroup struct {
+	//original is the file that's kept, a file already in the tree when there is one,
+	//otherwise the first file of the run in capture order
+	original *fileretrieveriface.RenameInfo
+	//duplicates are the files of this run with the same content as original
+	duplicates []*fileretrieveriface.RenameInfo
+}
+
+//findDuplicates groups the files of a run with the files already in the tree that have
+//the same md5 and size. files must be in the order they're renamed in. Only groups with
+//a duplicate among files are returned
+func findDuplicates(existing []*fileretrieveriface.RenameInfo, files []*fileretrieveriface.RenameInfo) []*duplicateGroup {
+	renaming := make(map[string]bool, len(files))
+	for _, file := range files {
+		renaming[file.ID] = true
+	}
+	//files already in the tree are sorted so the same one is kept each run
+	var kept []*fileretrieveriface.RenameInfo
+	for _, file := range existing {
+		if !renaming[file.ID] {
+			kept = append(kept, file)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].ID < kept[j].ID
+	})
+
+	groups := make(map[string]*duplicateGroup)
+	var found []*duplicateGroup
+	for _, file := range append(kept, files...) {
+		if file.MD5Checksum == "" {
+			continue
+		}
+		key := fmt.Sprintf("%s:%d", file.MD5Checksum, file.Size)
+		group, ok := groups[key]
+		if !ok {
+			groups[key] = &duplicateGroup{original: file}
+			continue
+		}
+		if !renaming[file.ID] {
+			continue
+		}
+		if len(group.duplicates) == 0 {
+			found = append(found, group)
+		}
+		group.duplicates = append(group.duplicates, file)
+	}
+	return found
+}
+
+//duplicateAction returns what is done with a duplicate instead of renaming it,
+//or an empty string when it's renamed
+func (r *Renamer) duplicateAction() string {
+	switch r.config.DuplicatePolicy {
+	case config.DuplicateQuarantine, config.DuplicateTrash:
+		return r.config.DuplicatePolicy
+	}
+	return ""
+}
+
+//applyDuplicateAction quarantines or trashes a duplicate
+func (r *Renamer) applyDuplicateAction(ctx context.Context, entry *PlanEntry) error {
+	if entry.Action == config.DuplicateTrash {
+		return r.fileRetriever.TrashFile(ctx, entry.file)
+	}
+	return r.fileRetriever.MoveFile(ctx, entry.file, r.config.QuarantineFolderID)
+}
+
+//summarizeDuplicates describes a duplicate group for the run summary
+func summarizeDuplicates(group *duplicateGroup) string {
+	names := make([]string, len(group.duplicates))
+	for i, file := range group.duplicates {
+		names[i] = file.Name
+	}
+	return fmt.Sprintf("%s duplicated by %s", group.original.Name, strings.Join(names, ", "))
+}
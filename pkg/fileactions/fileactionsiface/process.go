@@ -1,5 +1,8 @@
 package fileactionsiface
 
+import "context"
+
 type Process interface {
-	Run() error
-}
\ No newline at end of file
+	//Run stops once ctx is done, finishing the file it's on first
+	Run(ctx context.Context) error
+}
@@ -0,0 +1,108 @@
+package fileactions
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
+)
+
+//folderTemplate is a parsed folder template such as "{created:2006}/{created:01}",
+//with a template for each folder on the path
+type folderTemplate struct {
+	//source is the configured template this was parsed from
+	source  string
+	folders []*nameTemplate
+}
+
+//parseFolderTemplate parses a folder template. Folders can use the tokens of a name
+//template, other than the ones that only make sense in a file name
+func parseFolderTemplate(template string) (*folderTemplate, error) {
+	t := &folderTemplate{source: template}
+	for _, folder := range strings.Split(strings.Trim(template, "/"), "/") {
+		if folder == "" {
+			return nil, fmt.Errorf("folder template %q has an empty folder", template)
+		}
+		parsed, err := parseTemplate("folder", folder)
+		if err != nil {
+			return nil, err
+		}
+		for _, token := range []string{tokenCounter, tokenExt, tokenCleanStem} {
+			if parsed.hasToken(token) {
+				return nil, fmt.Errorf("{%s} can't be used in folder template %q", token, template)
+			}
+		}
+		t.folders = append(t.folders, parsed)
+	}
+	return t, nil
+}
+
+//render returns the name of each folder on the path. Folders that come out empty are left out
+func (t *folderTemplate) render(values *nameValues, s *sanitizer) []string {
+	var names []string
+	for _, folder := range t.folders {
+		name := s.fit(folder.parts(values, 0, s), s.cleanPart(values.sep))
+		if name == "" || name == "." || name == ".." {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+//movesFiles returns true when renamed files are moved to a destination folder
+func (r *Renamer) movesFiles() bool {
+	return r.config.FolderTemplate != "" || r.config.DestinationFolderID != ""
+}
+
+//destinationID returns the folder renamed files are moved under
+func (r *Renamer) destinationID() string {
+	if r.config.DestinationFolderID != "" {
+		return r.config.DestinationFolderID
+	}
+	return r.config.ParentDirID
+}
+
+//targetFolders returns the folders under the destination that file is moved to
+func (r *Renamer) targetFolders(file *fileretrieveriface.RenameInfo) ([]string, error) {
+	if r.config.FolderTemplate == "" {
+		return nil, nil
+	}
+	if r.folderTemplate == nil || r.folderTemplate.source != r.config.FolderTemplate {
+		template, err := parseFolderTemplate(r.config.FolderTemplate)
+		if err != nil {
+			return nil, err
+		}
+		r.folderTemplate = template
+	}
+	template, err := r.nameTemplate()
+	if err != nil {
+		return nil, err
+	}
+	values, err := r.nameValues(file, template)
+	if err != nil {
+		return nil, err
+	}
+	return r.folderTemplate.render(values, newSanitizer(r.config)), nil
+}
+
+//ensureFolder returns the id of the folder at path under the destination, finding or
+//creating each folder on the way. Each folder is only looked up once a run
+func (r *Renamer) ensureFolder(ctx context.Context, path []string) (string, error) {
+	id := r.destinationID()
+	for i, name := range path {
+		key := strings.Join(path[:i+1], "/")
+		if cached, ok := r.folders[key]; ok {
+			id = cached
+			continue
+		}
+		found, err := r.fileRetriever.FindOrCreateFolder(ctx, id, name)
+		if err != nil {
+			return "", err
+		}
+		r.folders[key] = found
+		id = found
+	}
+	return id, nil
+}
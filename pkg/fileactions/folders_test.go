@@ -0,0 +1,75 @@
+package fileactions
+
+import (
+	"context"
+	"time"
+
+	"github.com/davidparks11/file-renamer/pkg/config"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
+	"github.com/davidparks11/file-renamer/pkg/logger"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Folders", func() {
+	values := &nameValues{
+		words:   []string{"foo", "bar"},
+		sep:     "_",
+		created: time.Date(2020, 8, 31, 19, 0, 0, 0, time.UTC),
+	}
+
+	Describe("parseFolderTemplate()", func() {
+		It("should render a folder for each part of the path", func() {
+			template, err := parseFolderTemplate("{created:2006}/{created:2006-01-02}{sep}{words}/")
+			Expect(err).To(BeNil())
+			Expect(template.render(values, newSanitizer(&config.Config{}))).To(Equal([]string{"2020", "2020-08-31_foo_bar"}))
+		})
+
+		It("should leave out folders that come out empty", func() {
+			template, err := parseFolderTemplate("{created:2006}/{group:client}/{created:01}")
+			Expect(err).To(BeNil())
+			Expect(template.render(values, newSanitizer(&config.Config{}))).To(Equal([]string{"2020", "08"}))
+		})
+
+		It("should reject tokens that only belong in file names", func() {
+			_, err := parseFolderTemplate("{created:2006}/{counter}")
+			Expect(err).To(MatchError(ContainSubstring("{counter} can't be used")))
+			_, err = parseFolderTemplate("{created:2006}//{created:01}")
+			Expect(err).To(MatchError(ContainSubstring("empty folder")))
+		})
+	})
+
+	It("should move renamed files, finding each folder once a run", func() {
+		files := []*fileretrieveriface.RenameInfo{
+			{ID: "a", Name: "foo.mov", CreatedDate: "2020-08-31T19:00:00Z", ParentID: "inbox"},
+			{ID: "b", Name: "foo.mov", CreatedDate: "2020-08-31T20:00:00Z", ParentID: "inbox"},
+			{ID: "c", Name: "foo.mov", CreatedDate: "2020-09-01T08:00:00Z", ParentID: "inbox"},
+		}
+		mockRetriever := &fileretriever.MockFileRetriever{}
+		mockRetriever.On("GetFileInfo").Return(files, nil)
+		mockRetriever.On("GetExistingFiles").Return(files, nil)
+		mockRetriever.On("GetProcessedFiles").Return(map[string]bool{})
+		mockRetriever.On("FindOrCreateFolder", "archive", "2020").Return("2020-id", nil)
+		mockRetriever.On("FindOrCreateFolder", "2020-id", "08").Return("08-id", nil)
+		mockRetriever.On("FindOrCreateFolder", "2020-id", "09").Return("09-id", nil)
+		for _, file := range files {
+			mockRetriever.On("UpdateFile", file).Return(nil)
+		}
+
+		renamer := NewProcess(&logger.MockLogger{}, mockRetriever, nil, &config.Config{
+			PersistentWords:     []string{"foo"},
+			NameDelimiter:       "_",
+			FolderTemplate:      "{created:2006}/{created:01}",
+			DestinationFolderID: "archive",
+		})
+		Expect(renamer.Run(context.Background())).To(Succeed())
+
+		mockRetriever.AssertNumberOfCalls(GinkgoT(), "FindOrCreateFolder", 3)
+		Expect(files[0].Name).To(Equal("foo_2020_0831_0.mov"))
+		Expect(files[0].ParentID).To(Equal("08-id"))
+		Expect(files[1].ParentID).To(Equal("08-id"))
+		Expect(files[2].ParentID).To(Equal("09-id"))
+	})
+})
@@ -0,0 +1,137 @@
+package fileactions
+
+import (
+	"strings"
+
+	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
+)
+
+//fileGroup is a set of files in the same folder that share a stem, such as a raw file,
+//the jpeg shot with it and their xmp sidecar. They're renamed with the same new stem
+type fileGroup struct {
+	//stem is the stem the files share
+	stem string
+	//lead is the file the group is named by, the first file in capture order
+	//whose name is the stem and a single extension
+	lead *fileretrieveriface.RenameInfo
+	//members are the other files of the group
+	members []*fileretrieveriface.RenameInfo
+}
+
+//ext returns what follows the stem of the group in the name of file, such as .CR2.xmp
+func (g *fileGroup) ext(file *fileretrieveriface.RenameInfo) string {
+	return file.Name[len(g.stem):]
+}
+
+//splitExt splits name into its stem and extension, including the dot
+func splitExt(name string) (string, string) {
+	if i := strings.LastIndex(name, "."); i != -1 {
+		return name[:i], name[i:]
+	}
+	return name, ""
+}
+
+//findPairs groups files that are in the same folder and share a stem, ignoring case.
+//Sidecars named after the whole name of another file, such as IMG_0042.CR2.xmp, join
+//the group of that file. files must be in the order they're renamed in. The group of
+//every grouped file is returned by file id
+func findPairs(files []*fileretrieveriface.RenameInfo) map[string]*fileGroup {
+	type groupKey struct {
+		folder string
+		stem   string
+	}
+	keyOf := func(folder string, name string) groupKey {
+		stem, _ := splitExt(name)
+		return groupKey{folder: folder, stem: strings.ToLower(stem)}
+	}
+
+	byKey := make(map[groupKey][]*fileretrieveriface.RenameInfo)
+	var keys []groupKey
+	names := make(map[groupKey]bool)
+	for _, file := range files {
+		key := keyOf(file.ParentID, file.Name)
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		byKey[key] = append(byKey[key], file)
+		names[groupKey{folder: file.ParentID, stem: strings.ToLower(file.Name)}] = true
+	}
+	for _, key := range keys {
+		if !names[key] {
+			continue
+		}
+		//the stem is the whole name of another file, so these are its sidecars
+		outer := keyOf(key.folder, key.stem)
+		byKey[outer] = append(byKey[outer], byKey[key]...)
+		delete(byKey, key)
+	}
+
+	groups := make(map[string]*fileGroup)
+	for _, key := range keys {
+		candidates := sortedLike(files, byKey[key])
+		if len(candidates) < 2 {
+			continue
+		}
+		group := &fileGroup{}
+		for _, file := range candidates {
+			if stem, _ := splitExt(file.Name); strings.ToLower(stem) == key.stem {
+				group.lead, group.stem = file, stem
+				break
+			}
+		}
+		if group.lead == nil {
+			continue
+		}
+		//files are only grouped when their extensions tell them apart
+		exts := map[string]bool{strings.ToLower(group.ext(group.lead)): true}
+		for _, file := range candidates {
+			if file == group.lead || len(file.Name) <= len(group.stem) || !strings.EqualFold(file.Name[:len(group.stem)], group.stem) {
+				continue
+			}
+			ext := strings.ToLower(group.ext(file))
+			if exts[ext] {
+				continue
+			}
+			exts[ext] = true
+			group.members = append(group.members, file)
+		}
+		if len(group.members) == 0 {
+			continue
+		}
+		groups[group.lead.ID] = group
+		for _, file := range group.members {
+			groups[file.ID] = group
+		}
+	}
+	return groups
+}
+
+//sortedLike returns subset in the order its files appear in files
+func sortedLike(files []*fileretrieveriface.RenameInfo, subset []*fileretrieveriface.RenameInfo) []*fileretrieveriface.RenameInfo {
+	in := make(map[*fileretrieveriface.RenameInfo]bool, len(subset))
+	for _, file := range subset {
+		in[file] = true
+	}
+	var sorted []*fileretrieveriface.RenameInfo
+	for _, file := range files {
+		if in[file] {
+			sorted = append(sorted, file)
+		}
+	}
+	return sorted
+}
+
+//pairable returns the files that can be grouped, leaving out duplicates that
+//are moved instead of renamed
+func (r *Renamer) pairable(files []*fileretrieveriface.RenameInfo) []*fileretrieveriface.RenameInfo {
+	if r.duplicateAction() == "" {
+		return files
+	}
+	var pairable []*fileretrieveriface.RenameInfo
+	for _, file := range files {
+		if _, ok := r.duplicateOf[file.ID]; !ok {
+			pairable = append(pairable, file)
+		}
+	}
+	return pairable
+}
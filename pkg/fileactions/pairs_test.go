@@ -0,0 +1,92 @@
+package fileactions
+
+import (
+	"context"
+	"errors"
+
+	"github.com/davidparks11/file-renamer/pkg/config"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
+	"github.com/davidparks11/file-renamer/pkg/logger"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = Describe("Pairs", func() {
+	Describe("findPairs()", func() {
+		It("should group files sharing a stem in the same folder, along with their sidecars", func() {
+			files := []*fileretrieveriface.RenameInfo{
+				{ID: "a", Name: "IMG_0042.JPG", ParentID: "inbox"},
+				{ID: "b", Name: "IMG_0042.CR2", ParentID: "inbox"},
+				{ID: "c", Name: "img_0042.CR2.xmp", ParentID: "inbox"},
+				{ID: "d", Name: "IMG_0042.JPG", ParentID: "other"},
+				{ID: "e", Name: "IMG_0043.JPG", ParentID: "inbox"},
+			}
+			groups := findPairs(files)
+
+			Expect(groups).To(HaveLen(3))
+			group := groups["a"]
+			Expect(group.lead).To(Equal(files[0]))
+			Expect(group.members).To(Equal([]*fileretrieveriface.RenameInfo{files[1], files[2]}))
+			Expect(group.ext(files[2])).To(Equal(".CR2.xmp"))
+			Expect(groups["b"]).To(Equal(group))
+			Expect(groups["c"]).To(Equal(group))
+		})
+	})
+
+	var (
+		files         []*fileretrieveriface.RenameInfo
+		mockRetriever *fileretriever.MockFileRetriever
+		cfg           *config.Config
+	)
+
+	BeforeEach(func() {
+		files = []*fileretrieveriface.RenameInfo{
+			{ID: "a", Name: "foo.jpg", CreatedDate: "2020-08-31T19:00:00Z"},
+			{ID: "b", Name: "foo.cr2", CreatedDate: "2020-08-31T19:00:01Z"},
+			{ID: "c", Name: "foo.cr2.xmp", CreatedDate: "2020-08-31T19:00:02Z"},
+		}
+		mockRetriever = &fileretriever.MockFileRetriever{}
+		mockRetriever.On("GetFileInfo").Return(files, nil)
+		mockRetriever.On("GetProcessedFiles").Return(map[string]bool{})
+		cfg = &config.Config{
+			PersistentWords: []string{"foo"},
+			NameDelimiter:   "_",
+			PairByStem:      true,
+		}
+	})
+
+	It("should give every file of a group the same new stem", func() {
+		cfg.CollisionStrategy = config.CollisionBump
+		taken := &fileretrieveriface.RenameInfo{ID: "x", Name: "foo_2020_0831_0.cr2"}
+		mockRetriever.On("GetExistingFiles").Return(append([]*fileretrieveriface.RenameInfo{taken}, files...), nil)
+		mockRetriever.On("UpdateFile", mock.Anything).Return(nil)
+
+		Expect(NewProcess(&logger.MockLogger{}, mockRetriever, nil, cfg).Run(context.Background())).To(Succeed())
+
+		Expect(files[0].Name).To(Equal("foo_2020_0831_1.jpg"))
+		Expect(files[1].Name).To(Equal("foo_2020_0831_1.cr2"))
+		Expect(files[2].Name).To(Equal("foo_2020_0831_1.cr2.xmp"))
+	})
+
+	It("should put back the files of a group when one of them fails", func() {
+		mockRetriever.On("GetExistingFiles").Return(files, nil)
+		mockRetriever.On("UpdateFile", files[0]).Return(nil)
+		mockRetriever.On("UpdateFile", files[1]).Return(errors.New("rate limited"))
+		mockRetriever.On("RevertFile", mock.Anything).Return(nil)
+
+		Expect(NewProcess(&logger.MockLogger{}, mockRetriever, nil, cfg).Run(context.Background())).To(Succeed())
+
+		mockRetriever.AssertNotCalled(GinkgoT(), "UpdateFile", files[2])
+		mockRetriever.AssertCalled(GinkgoT(), "RevertFile", &fileretrieveriface.RenameInfo{ID: "a", Name: "foo.jpg"})
+	})
+
+	It("should need an {ext} token in the name template", func() {
+		cfg.NameTemplate = "{words}{sep}{counter}"
+		problems := ValidateConfig(cfg)
+		Expect(problems).To(HaveLen(1))
+		Expect(problems[0].Field).To(Equal("pairByStem"))
+	})
+})
@@ -0,0 +1,107 @@
+package fileactions
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
+)
+
+const (
+	//PlanFormatTable writes the plan as aligned columns. This is the default format
+	PlanFormatTable = "table"
+	//PlanFormatJSON writes the plan as a json array
+	PlanFormatJSON = "json"
+	//PlanFormatCSV writes the plan as csv with a header row
+	PlanFormatCSV = "csv"
+)
+
+//PlanEntry describes a single rename that a Renamer would perform
+type PlanEntry struct {
+	ID           string   `json:"id"`
+	OldName      string   `json:"oldName"`
+	NewName      string   `json:"newName"`
+	MatchedWords []string `json:"matchedWords"`
+	Date         string   `json:"date"`
+	DateSource   string   `json:"dateSource"`
+	//MatchedAliases maps each persistent word matched by an alias, or fuzzily, to the text that matched
+	MatchedAliases map[string]string `json:"matchedAliases,omitempty"`
+	//DuplicateOf is the name of the file with the same content that's kept, when the file is a duplicate
+	DuplicateOf string `json:"duplicateOf,omitempty"`
+	//Action is quarantine or trash when the duplicate is moved instead of renamed
+	Action string `json:"action,omitempty"`
+	//Folder is the path of the folder under the destination the file is moved to
+	Folder string `json:"folder,omitempty"`
+	//PairedWith is the old name of the file this file shares a stem with and is named by
+	PairedWith string `json:"pairedWith,omitempty"`
+	//file is the file the entry renames
+	file *fileretrieveriface.RenameInfo
+	//folders holds the name of each folder on the path of Folder
+	folders []string
+	//paired holds the entries of the files named by this one
+	paired []*PlanEntry
+}
+
+var planHeader = []string{"ID", "OLD NAME", "NEW NAME", "MATCHED WORDS", "DATE", "DATE SOURCE"}
+
+func (p *PlanEntry) columns() []string {
+	//words matched by an alias are shown with the alias, such as landscape(lndscp)
+	words := make([]string, len(p.MatchedWords))
+	for i, word := range p.MatchedWords {
+		words[i] = word
+		if alias, ok := p.MatchedAliases[word]; ok {
+			words[i] = word + "(" + alias + ")"
+		}
+	}
+	newName := p.NewName
+	if p.Folder != "" {
+		newName = p.Folder + "/" + newName
+	}
+	if p.Action != "" {
+		newName = "(" + p.Action + ")"
+	}
+	return []string{p.ID, p.OldName, newName, strings.Join(words, ","), p.Date, p.DateSource}
+}
+
+//isPlanFormat returns true for formats WritePlan can write
+func isPlanFormat(format string) bool {
+	switch strings.ToLower(format) {
+	case "", PlanFormatTable, PlanFormatJSON, PlanFormatCSV:
+		return true
+	}
+	return false
+}
+
+//WritePlan writes plan to w in the given format
+func WritePlan(w io.Writer, format string, plan []*PlanEntry) error {
+	switch strings.ToLower(format) {
+	case "", PlanFormatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(planHeader, "\t"))
+		for _, entry := range plan {
+			fmt.Fprintln(tw, strings.Join(entry.columns(), "\t"))
+		}
+		return tw.Flush()
+	case PlanFormatJSON:
+		if plan == nil {
+			plan = []*PlanEntry{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(plan)
+	case PlanFormatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(planHeader)
+		for _, entry := range plan {
+			cw.Write(entry.columns())
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown plan format %s", format)
+	}
+}
@@ -0,0 +1,71 @@
+package fileactions
+
+import (
+	"context"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/davidparks11/file-renamer/pkg/config"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
+	"github.com/davidparks11/file-renamer/pkg/logger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Plan", func() {
+	plan := []*PlanEntry{
+		{ID: "11111111", OldName: "foofile1.mov", NewName: "foo_2020_0831_0.mov", MatchedWords: []string{"foo"}, Date: "2020-08-31T19:33:44.561Z", DateSource: "createdDate"},
+	}
+
+	Describe("WritePlan()", func() {
+		It("should write a header and a row per entry as csv", func() {
+			buf := &bytes.Buffer{}
+			Expect(WritePlan(buf, PlanFormatCSV, plan)).To(Succeed())
+			Expect(buf.String()).To(Equal("ID,OLD NAME,NEW NAME,MATCHED WORDS,DATE,DATE SOURCE\n" +
+				"11111111,foofile1.mov,foo_2020_0831_0.mov,foo,2020-08-31T19:33:44.561Z,createdDate\n"))
+		})
+		It("should reject unknown formats", func() {
+			Expect(WritePlan(&bytes.Buffer{}, "xml", plan)).NotTo(Succeed())
+		})
+	})
+
+	Describe("Run() with dryRun", func() {
+		It("should write the plan without updating any files", func() {
+			dir, err := ioutil.TempDir("", "plan")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(dir)
+			planPath := filepath.Join(dir, "plan.json")
+
+			//no UpdateFile expectation, so the mock panics if a file is updated
+			mockRetriever := &fileretriever.MockFileRetriever{}
+			mockRetriever.On("GetFileInfo").Return([]*fileretrieveriface.RenameInfo{
+				{ID: "11111111", Name: "foofile1.mov", CreatedDate: "2020-08-31T19:33:44.561Z"},
+				{ID: "22222222", Name: "foofile1.mov", CreatedDate: "2020-08-31T19:33:44.561Z"},
+			}, nil)
+			mockRetriever.On("GetProcessedFiles").Return(map[string]bool{})
+			mockRetriever.On("GetExistingFiles").Return([]*fileretrieveriface.RenameInfo{}, nil)
+
+			renamer := NewProcess(&logger.MockLogger{}, mockRetriever, nil, &config.Config{
+				PersistentWords: []string{"foo"},
+				NameDelimiter:   "_",
+				DryRun:          true,
+				PlanFormat:      PlanFormatJSON,
+				PlanOutput:      planPath,
+			})
+			Expect(renamer.Run(context.Background())).To(Succeed())
+
+			b, err := ioutil.ReadFile(planPath)
+			Expect(err).To(BeNil())
+			var written []*PlanEntry
+			Expect(json.Unmarshal(b, &written)).To(Succeed())
+			Expect(written).To(HaveLen(2))
+			Expect(written[0].NewName).To(Equal("foo_2020_0831_0.mov"))
+			Expect(written[1].NewName).To(Equal("foo_2020_0831_1.mov"))
+			Expect(written[1].MatchedWords).To(Equal([]string{"foo"}))
+		})
+	})
+})
@@ -1,13 +1,21 @@
 package fileactions
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/davidparks11/file-renamer/pkg/config"
 	"github.com/davidparks11/file-renamer/pkg/fileactions/fileactionsiface"
 	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
+	"github.com/davidparks11/file-renamer/pkg/journal/journaliface"
 	"github.com/davidparks11/file-renamer/pkg/logger/loggeriface"
 )
 
@@ -20,89 +28,794 @@ type Renamer struct {
 	name string
 	config *config.Config
 	processedFiles map[string]bool
+	journal journaliface.Journal
+	template *nameTemplate
+	rules []*renameRule
+	//counters holds the next counter of each counter scope during a run
+	counters map[string]int
+	//taken maps the names of existing files to their ids, by collision folder
+	taken map[string]map[string]string
+	//duplicates holds the groups of files with the same content found by the run
+	duplicates []*duplicateGroup
+	//duplicateOf maps the id of each duplicate to the file that's kept
+	duplicateOf map[string]*fileretrieveriface.RenameInfo
+	folderTemplate *folderTemplate
+	//folders maps each folder path under the destination to its id, once it's been found during a run
+	folders map[string]string
+	//pairs maps the id of every file that shares a stem with other files to its group
+	pairs map[string]*fileGroup
+	//checkpoint is the plan being applied and its progress, nil unless checkpointPath is set
+	checkpoint *checkpoint
+	//planWriter is where a dry run plan is written when there is no plan output
+	planWriter io.Writer
 }
 
 //NewProcess returns a Renamer that uniquely names each file based 
-//on its configured persistent words and creation date
-func NewProcess(logger loggeriface.Service, fileRetriever fileretrieveriface.FileRetriever, config *config.Config) fileactionsiface.Process {
+//on its configured persistent words and creation date.
+//Every rename is recorded in journal so it can be undone
+func NewProcess(logger loggeriface.Service, fileRetriever fileretrieveriface.FileRetriever, journal journaliface.Journal, config *config.Config) fileactionsiface.Process {
 	return &Renamer{
 		logger: logger,
 		fileRetriever: fileRetriever,
+		journal: journal,
 		name: "File-Renamer",
 		config: config,
 		processedFiles: nil,
+		planWriter: os.Stdout,
 	}
 }
 
+//SetPlanWriter makes dry runs write their plan to w instead of stdout, when there is no plan output
+func (r *Renamer) SetPlanWriter(w io.Writer) {
+	r.planWriter = w
+}
+
 //allows control of time for testing
 var now = func() time.Time {
 	return time.Now()
 }
 
-//Run is called on a repeated schedule by a scheduler
-func (r *Renamer) Run() error {
-	r.logger.Info(fmt.Sprintf("~~~~ %s started ~~~~", r.name))
-	files, err := r.fileRetriever.GetFileInfo()
+//newRunID returns an identifier for a run, used to undo every rename made by the run
+func newRunID() string {
+	return now().UTC().Format("20060102T150405.000Z")
+}
+
+//Run is called on a repeated schedule by a scheduler. Once ctx is done, or the run
+//has taken runTimeout, the files being updated are finished and the rest are left
+//for the next run
+func (r *Renamer) Run(ctx context.Context) error {
+	ctx, cancel, err := r.withRunTimeout(ctx)
 	if err != nil {
 		return err
 	}
+	defer cancel()
+	r.logger.Info(fmt.Sprintf("~~~~ %s started ~~~~", r.name))
+	runID := newRunID()
+	if r.config.Name != "" {
+		//jobs on the same schedule start together, the name keeps their run IDs apart
+		runID += "-" + r.config.Name
+	}
+	files, err := r.fileRetriever.GetFileInfo(ctx)
+	if err != nil {
+		return stoppedEarly(ctx, err)
+	}
+	if r.config.CheckpointPath != "" && !r.config.DryRun {
+		saved, err := r.loadCheckpoint()
+		if err != nil {
+			return err
+		}
+		if saved != nil {
+			//new files are left for the next run, so they can't change the numbers planned
+			err = r.resume(ctx, saved, files)
+			r.logger.Info(fmt.Sprintf("~~~~ %s ended ~~~~", r.name))
+			return err
+		}
+	}
+	if !r.config.DryRun {
+		r.logger.Info("Run ID " + runID)
+	}
 
 	//get all processed files. Runs each time in case of deletions
-	r.processedFiles = r.fileRetriever.GetProcessedFiles()
+	r.processedFiles = r.fileRetriever.GetProcessedFiles(ctx)
+	if err = ctx.Err(); err != nil {
+		//the processed files may be incomplete, so no names can be trusted
+		return stoppedEarly(ctx, err)
+	}
+	r.counters = make(map[string]int)
+	//counters are handed out in capture order so reruns give each file the same number
+	r.sortByCaptureDate(files)
 
+	r.taken = nil
+	r.folders = make(map[string]string)
+	r.duplicates = nil
+	r.duplicateOf = make(map[string]*fileretrieveriface.RenameInfo)
+	if len(files) > 0 {
+		if err = r.inspectExisting(ctx, files); err != nil {
+			return stoppedEarly(ctx, err)
+		}
+	}
+	r.pairs = nil
+	if r.config.PairByStem {
+		r.pairs = findPairs(r.pairable(files))
+	}
+
+	//every name is worked out before anything is changed, so a run that fails
+	//on a taken name doesn't leave half the files renamed
+	var plan []*PlanEntry
+	aliasCounts := make(map[string]int)
 	for _, file := range files {
-		file.Name, err = r.generateNewName(file.Name, file.CreatedDate)
+		original, duplicate := r.duplicateOf[file.ID]
+		if duplicate && r.duplicateAction() != "" {
+			plan = append(plan, &PlanEntry{ID: file.ID, OldName: file.Name, DuplicateOf: original.Name, Action: r.duplicateAction(), file: file})
+			continue
+		}
+		if group, ok := r.pairs[file.ID]; ok && group.lead != file {
+			//planned along with the lead of its group
+			continue
+		}
+		entries, err := r.planRename(file)
+		if taken, ok := err.(*nameTakenError); ok {
+			if r.config.CollisionStrategy == config.CollisionFail {
+				return fmt.Errorf("new name of %s failed - %s, no files were renamed", file.ID, taken.Error())
+			}
+			r.logger.Warn(fmt.Sprintf("Skipping %s - %s", file.ID, taken.Error()))
+			continue
+		}
 		if err != nil {
 			//skip file if error is encountered
 			r.logger.Error(fmt.Sprintf("Error generating new file name %s - %s", file.ID, err.Error()))
 			continue
 		}
-		err = r.fileRetriever.UpdateFile(file)
+		if duplicate {
+			entries[0].DuplicateOf = original.Name
+		}
+		if unchanged(entries) {
+			//renaming it to the name it has would leave a journal entry for a rename that never happened
+			r.processedFiles[entries[0].NewName] = true
+			r.logger.Info(fmt.Sprintf("Skipping %s - it already has its new name %s", file.ID, file.Name))
+			continue
+		}
+		for word, alias := range entries[0].MatchedAliases {
+			aliasCounts[fmt.Sprintf("%s by %q", word, alias)]++
+		}
+		for _, entry := range entries {
+			//reserve the name so the next duplicate gets the next number
+			r.processedFiles[entry.NewName] = true
+			plan = append(plan, entry)
+		}
+	}
+
+	for _, group := range r.duplicates {
+		r.logger.Info("Duplicate files: " + summarizeDuplicates(group))
+	}
+	if r.config.DryRun {
+		if err = r.writePlan(plan); err != nil {
+			return err
+		}
+		r.logger.Info(fmt.Sprintf("Dry run planned %d renames", len(plan)))
+	} else {
+		if r.config.CheckpointPath != "" && len(plan) > 0 {
+			r.checkpoint = r.newCheckpoint(runID, plan)
+			if err = r.checkpoint.save(); err != nil {
+				r.logger.Error("Unable to save checkpoint, the run can't be resumed if it stops: " + err.Error())
+			}
+		}
+		err = r.applyPlan(ctx, runID, plan)
+		r.finishCheckpoint(err != nil)
 		if err != nil {
-			r.logger.Error(fmt.Sprintf("Error updating file %s:%s - %s", file.Name, file.ID, err.Error()))
+			r.logger.Info(fmt.Sprintf("~~~~ %s stopped ~~~~", r.name))
+			return err
 		}
-		r.logger.Info("Updated file name to " + file.Name)
-		r.processedFiles[file.Name] = true
+	}
+	if len(aliasCounts) > 0 {
+		r.logger.Info("Persistent words matched by alias: " + summarizeAliases(aliasCounts))
 	}
 	r.logger.Info(fmt.Sprintf("~~~~ %s ended ~~~~", r.name))
 	return nil
 }
 
-//FIRSTNAME_GAMEMODE_YYYY_MMDD_#.
+//stoppedEarly says nothing was renamed when err is from ctx being done before the plan was made
+func stoppedEarly(ctx context.Context, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+	return fmt.Errorf("run stopped before any file was renamed - %s", err.Error())
+}
 
-func (r *Renamer) generateNewName(name string, createdDate string) (string, error) {
-	var newName string
-	var suffix string
+//inspectExisting looks through the files already under the parent folder for the names
+//new names must avoid and, when a duplicate policy is set, for files with the same content.
+//Listing the whole tree defeats incremental sync, so it's skipped when neither is on
+func (r *Renamer) inspectExisting(ctx context.Context, files []*fileretrieveriface.RenameInfo) error {
+	if !r.checksCollisions() && r.config.DuplicatePolicy == "" {
+		return nil
+	}
+	existing, err := r.fileRetriever.GetExistingFiles(ctx)
+	if err != nil {
+		return err
+	}
+	if r.checksCollisions() {
+		r.loadTakenNames(existing)
+	}
+	if r.config.DuplicatePolicy == "" {
+		return nil
+	}
+	r.duplicates = findDuplicates(existing, files)
+	for _, group := range r.duplicates {
+		for _, file := range group.duplicates {
+			r.duplicateOf[file.ID] = group.original
+		}
+	}
+	return nil
+}
 
-	//extrac suffix
-	suffixIndex := strings.LastIndex(name, ".")
-	if suffixIndex == -1 {
-		suffix = ""
-	} else {
-		suffix = name[suffixIndex:]
+//applyPlan makes the planned changes, recording every rename in the journal. Names are
+//all worked out before this, so the updates can be spread over the workers in any order.
+//If ctx is done first, an error says how many changes were left for the next run
+func (r *Renamer) applyPlan(ctx context.Context, runID string, plan []*PlanEntry) error {
+	var tasks []func(context.Context)
+	//sizes holds the number of files each task changes
+	var sizes []int
+	for _, entry := range plan {
+		entry := entry
+		if entry.Action != "" {
+			tasks = append(tasks, func(ctx context.Context) { r.applyDuplicate(ctx, entry) })
+			sizes = append(sizes, 1)
+			continue
+		}
+		if entry.PairedWith != "" {
+			//renamed along with the lead of its group
+			continue
+		}
+		parentID := ""
+		if r.movesFiles() {
+			//folders are found up front so two workers never create the same folder
+			var err error
+			if parentID, err = r.ensureFolder(ctx, entry.folders); err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				r.logger.Error(fmt.Sprintf("Error finding folder %s for %s:%s - %s", entry.Folder, entry.OldName, entry.ID, err.Error()))
+				continue
+			}
+		}
+		group := append([]*PlanEntry{entry}, entry.paired...)
+		tasks = append(tasks, func(ctx context.Context) { r.applyRenames(ctx, runID, group, parentID) })
+		sizes = append(sizes, len(group))
+	}
+	started := r.runWorkers(ctx, tasks)
+	if err := ctx.Err(); err != nil {
+		done := 0
+		for _, size := range sizes[:started] {
+			done += size
+		}
+		//every change that was made is in the journal, the rest are planned again next run
+		return fmt.Errorf("run stopped after %d of %d planned changes, the rest are left for the next run - %s", done, len(plan), err.Error())
+	}
+	return nil
+}
+
+//applyDuplicate moves a duplicate file as the duplicate policy says
+func (r *Renamer) applyDuplicate(ctx context.Context, entry *PlanEntry) {
+	if err := r.applyDuplicateAction(ctx, entry); err != nil {
+		r.logger.Error(fmt.Sprintf("Error moving duplicate %s:%s to %s - %s", entry.file.Name, entry.file.ID, entry.Action, err.Error()))
+		return
+	}
+	r.logger.Info(fmt.Sprintf("Moved duplicate %s to %s", entry.OldName, entry.Action))
+	r.markDone(entry)
+}
+
+//renamed is a file that's been updated, with the folder it was in before
+type renamed struct {
+	entry       *PlanEntry
+	oldParentID string
+}
+
+//applyRenames renames the files of a group together, moving them to the folder with parentID
+//if it's set. If one fails, the files already renamed are reverted so the group isn't left
+//partly processed
+func (r *Renamer) applyRenames(ctx context.Context, runID string, group []*PlanEntry, parentID string) {
+	var done []*renamed
+	for _, entry := range group {
+		file := entry.file
+		file.TargetParentID = parentID
+		file.OriginalName = file.Name
+		file.Name = entry.NewName
+		oldParentID := file.ParentID
+		err := r.fileRetriever.UpdateFile(ctx, file)
+		if err != nil {
+			r.logger.Error(fmt.Sprintf("Error updating file %s:%s - %s", file.Name, file.ID, err.Error()))
+			r.revertRenames(ctx, runID, done)
+			return
+		}
+		if file.TargetParentID != "" {
+			file.ParentID = file.TargetParentID
+		}
+		done = append(done, &renamed{entry: entry, oldParentID: oldParentID})
 	}
-		
-	//add any persistent words to the the new name
-	for _, word := range r.config.PersistentWords {
-		if strings.Contains(strings.ToLower(name), strings.ToLower(word)) {
-			newName += word + r.config.NameDelimiter
+
+	for _, rename := range done {
+		file := rename.entry.file
+		if file.ParentID != rename.oldParentID {
+			r.logger.Info(fmt.Sprintf("Updated file name to %s and moved it to %s using date from %s", file.Name, rename.entry.Folder, file.DateSource))
+		} else {
+			r.logger.Info(fmt.Sprintf("Updated file name to %s using date from %s", file.Name, file.DateSource))
 		}
+		r.recordRename(runID, file, rename.oldParentID)
+		r.markDone(rename.entry)
 	}
+}
 
-	parsedDate, err := r.parseRFC3339(createdDate)
+//revertRenames puts back the files of a group that were renamed before another file of the
+//group failed. A file that can't be put back is journaled, so it can still be undone
+func (r *Renamer) revertRenames(ctx context.Context, runID string, done []*renamed) {
+	for _, rename := range done {
+		file := rename.entry.file
+		info := &fileretrieveriface.RenameInfo{
+			ID:       file.ID,
+			Name:     file.OriginalName,
+			ParentID: file.ParentID,
+		}
+		if file.ParentID != rename.oldParentID {
+			info.TargetParentID = rename.oldParentID
+		}
+		if err := r.fileRetriever.RevertFile(ctx, info); err != nil {
+			r.logger.Error(fmt.Sprintf("Error reverting %s to %s after a paired file failed - %s", file.Name, file.OriginalName, err.Error()))
+			r.recordRename(runID, file, rename.oldParentID)
+			continue
+		}
+		r.logger.Warn(fmt.Sprintf("Reverted %s to %s since a paired file failed", file.Name, file.OriginalName))
+	}
+}
+
+//recordRename writes a completed rename to the journal, along with the folder
+//the file was in when it was moved
+func (r *Renamer) recordRename(runID string, file *fileretrieveriface.RenameInfo, oldParentID string) {
+	if r.journal == nil {
+		return
+	}
+	entry := &journaliface.Entry{
+		Action:    journaliface.ActionRename,
+		RunID:     runID,
+		FileID:    file.ID,
+		OldName:   file.OriginalName,
+		NewName:   file.Name,
+		Timestamp: now(),
+		Job:       r.config.Name,
+	}
+	if file.ParentID != oldParentID {
+		entry.OldParentID = oldParentID
+		entry.NewParentID = file.ParentID
+	}
+	err := r.journal.Record(entry)
+	if err != nil {
+		r.logger.Error(fmt.Sprintf("Error recording rename of %s in journal - %s", file.ID, err.Error()))
+	}
+}
+
+//planRename works out the new name of a file, followed by the new names of the files
+//paired with it, without changing anything other than recording the source of the date used
+func (r *Renamer) planRename(file *fileretrieveriface.RenameInfo) ([]*PlanEntry, error) {
+	date, source, err := r.captureDate(file)
+	if err != nil {
+		return nil, err
+	}
+	file.DateSource = source
+
+	newNames, err := r.generateNames(file)
+	if err != nil {
+		return nil, err
+	}
+	folders, err := r.targetFolders(file)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := r.matchWords(file.Name)
+	if err != nil {
+		return nil, err
+	}
+	entry := &PlanEntry{
+		ID:           file.ID,
+		OldName:      file.Name,
+		NewName:      newNames[0],
+		MatchedWords: matches.words,
+		Date:         date,
+		DateSource:   source,
+		Folder:       strings.Join(folders, "/"),
+		file:         file,
+		folders:      folders,
+	}
+	if len(matches.aliases) > 0 {
+		entry.MatchedAliases = matches.aliases
+	}
+
+	entries := []*PlanEntry{entry}
+	if group, ok := r.pairs[file.ID]; ok {
+		for i, member := range group.members {
+			member.DateSource = source
+			paired := *entry
+			paired.ID, paired.OldName, paired.NewName = member.ID, member.Name, newNames[i+1]
+			paired.PairedWith = file.Name
+			paired.file = member
+			entry.paired = append(entry.paired, &paired)
+			entries = append(entries, &paired)
+		}
+	}
+	return entries, nil
+}
+
+//unchanged returns true when none of the planned files would get a new name or be moved
+func unchanged(entries []*PlanEntry) bool {
+	for _, entry := range entries {
+		if entry.NewName != entry.OldName || len(entry.folders) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+//defaultDateSources keeps naming files by their creation date
+var defaultDateSources = []string{fileretrieveriface.DateSourceCreated}
+
+//captureDate returns the first date found by walking the configured date source chain
+func (r *Renamer) captureDate(file *fileretrieveriface.RenameInfo) (string, string, error) {
+	sources := r.config.DateSources
+	if len(sources) == 0 {
+		sources = defaultDateSources
+	}
+	for _, source := range sources {
+		date := file.Dates[source]
+		if date == "" && source == fileretrieveriface.DateSourceCreated {
+			date = file.CreatedDate
+		}
+		if date != "" {
+			return date, source, nil
+		}
+	}
+	return "", "", fmt.Errorf("no date found from sources %s", strings.Join(sources, ", "))
+}
+
+//writePlan writes a dry run plan to the configured plan output, or the plan writer if there is none
+func (r *Renamer) writePlan(plan []*PlanEntry) error {
+	w := r.planWriter
+	if r.config.PlanOutput != "" {
+		file, err := os.Create(r.config.PlanOutput)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	return WritePlan(w, r.config.PlanFormat, plan)
+}
+
+//generateNewName names a file using only its current name and creation date
+func (r *Renamer) generateNewName(name string, createdDate string) (string, error) {
+	return r.generateName(&fileretrieveriface.RenameInfo{Name: name, CreatedDate: createdDate})
+}
+
+//generateName fills the name template for file, using the lowest counter
+//that doesn't give the name of an already processed file. A name held by any other
+//existing file is passed over too, unless the collision strategy says otherwise
+func (r *Renamer) generateName(file *fileretrieveriface.RenameInfo) (string, error) {
+	names, err := r.generateNames(file)
 	if err != nil {
 		return "", err
 	}
-	newName += parsedDate + r.config.NameDelimiter
+	return names[0], nil
+}
 
-	var dupCheck string
-	for dupFileCount := 0; true; dupFileCount++ {
-		dupCheck = fmt.Sprintf("%s%d%s", newName, dupFileCount, suffix)
-		if r.processedFiles[dupCheck] == false {
+//generateNames names file like generateName, followed by the names of the files paired
+//with it. They share a counter, the lowest that gives none of them a taken name
+func (r *Renamer) generateNames(file *fileretrieveriface.RenameInfo) ([]string, error) {
+	template, err := r.nameTemplate()
+	if err != nil {
+		return nil, err
+	}
+	values, err := r.nameValues(file, template)
+	if err != nil {
+		return nil, err
+	}
+	named := []*fileretrieveriface.RenameInfo{file}
+	exts := []string{values.ext}
+	if group, ok := r.pairs[file.ID]; ok {
+		for _, member := range group.members {
+			named = append(named, member)
+			exts = append(exts, group.ext(member))
+		}
+	}
+
+	safe := newSanitizer(r.config)
+	scope := r.counterScope(values.matched, values.created)
+	var names []string
+	dupFileCount := r.config.CounterStart
+	if next, ok := r.counters[scope]; ok {
+		dupFileCount = next
+	} else if r.counters != nil && r.sharesCounters() {
+		dupFileCount = r.seedCounter(template, values, safe)
+	}
+	for ; true; dupFileCount++ {
+		names = names[:0]
+		processed, taken := false, ""
+		for i, ext := range exts {
+			values.ext = ext
+			dupCheck := template.renderSafe(values, dupFileCount, safe)
+			names = append(names, dupCheck)
+			if r.processedFiles[dupCheck] {
+				processed = true
+			} else if taken == "" && r.isTaken(dupCheck, named[i]) {
+				taken = dupCheck
+			}
+		}
+		if processed {
+			continue
+		}
+		if taken == "" {
 			break
 		}
+		if !r.bumpsCollisions() {
+			return nil, &nameTakenError{name: taken}
+		}
+	}
+	if r.counters != nil && r.sharesCounters() {
+		r.counters[scope] = dupFileCount + 1
+	}
+	return names, nil
+}
+
+//nameValues gathers everything template can put in the name of file
+func (r *Renamer) nameValues(file *fileretrieveriface.RenameInfo, template *nameTemplate) (*nameValues, error) {
+	date, _, err := r.captureDate(file)
+	if err != nil {
+		return nil, err
+	}
+	created, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		return nil, err
+	}
+
+	//extract suffix
+	stem, suffix := file.Name, ""
+	if suffixIndex := strings.LastIndex(file.Name, "."); suffixIndex != -1 {
+		stem, suffix = file.Name[:suffixIndex], file.Name[suffixIndex:]
+	}
+
+	matches, err := r.matchWords(file.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	keptStem := ""
+	if template.hasToken(tokenCleanStem) {
+		keptStem = cleanStem(stem, r.stemWords(matches), created, template.createdLayouts(), r.config.NameDelimiter, r.config.StemMaxLength)
+	}
+
+	words := matches.words
+	if _, ok := r.duplicateOf[file.ID]; ok && r.config.DuplicatePolicy == config.DuplicateTag {
+		words = append(append([]string{}, words...), duplicateMarker)
+	}
+
+	return &nameValues{
+		words:     words,
+		matched:   matches.words,
+		groups:    matches.groups,
+		sep:       r.config.NameDelimiter,
+		created:   created,
+		stem:      stem,
+		cleanStem: keptStem,
+		ext:       suffix,
+		parent:    file.ParentName,
+		owner:     file.Owner,
+		mime:      file.MimeType,
+	}, nil
+}
+
+//counterScope returns the key of the counter a file is numbered by. Files sharing a
+//key share a counter. The default name scope needs no key, since the processed names
+//already tell which counters of a name are taken
+func (r *Renamer) counterScope(words []string, created time.Time) string {
+	switch r.config.CounterScope {
+	case config.CounterScopeDay:
+		return created.Format("2006-01-02")
+	case config.CounterScopeWords:
+		return strings.ToLower(strings.Join(words, "\x00"))
+	}
+	return ""
+}
+
+//sharesCounters returns true when the counter scope is shared by names that differ
+func (r *Renamer) sharesCounters() bool {
+	return r.config.CounterScope != "" && r.config.CounterScope != config.CounterScopeName
+}
+
+//seedCounter returns the first counter of the scope of values in this run. It follows
+//the highest counter already given in the scope, found in the processed and existing
+//names, so a scope keeps counting up across runs instead of starting over
+func (r *Renamer) seedCounter(template *nameTemplate, values *nameValues, s *sanitizer) int {
+	seed := r.config.CounterStart
+	pattern := r.scopePattern(template, values, s)
+	check := func(name string) {
+		match := pattern.FindStringSubmatch(name)
+		if match == nil {
+			return
+		}
+		if counter, err := strconv.Atoi(match[1]); err == nil && counter >= seed {
+			seed = counter + 1
+		}
+	}
+	for name := range r.processedFiles {
+		check(name)
+	}
+	for _, names := range r.taken {
+		for name := range names {
+			check(name)
+		}
+	}
+	return seed
+}
+
+//scopePattern returns a pattern matching the names template gives in the counter scope
+//of values, capturing the counter. Tokens the scope is keyed by must match, the rest
+//can be anything. Wildcards don't end or start next to the counter with a digit, so
+//every digit of the counter is captured
+func (r *Renamer) scopePattern(template *nameTemplate, values *nameValues, s *sanitizer) *regexp.Regexp {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	counted := false
+	for _, segment := range template.segments {
+		wildcard := `(?:.*\D)?`
+		if counted {
+			wildcard = `(?:\D.*)?`
+		}
+		switch {
+		case segment.token == "":
+			pattern.WriteString(regexp.QuoteMeta(s.cleanPart(segment.literal)))
+		case segment.token == tokenSep:
+			pattern.WriteString("(?:" + regexp.QuoteMeta(s.cleanPart(values.sep)) + ")?")
+		case segment.token == tokenCounter:
+			pattern.WriteString(`(\d+)`)
+			counted = true
+		case segment.token == tokenExt && values.ext != "":
+			//files of any type share the counter, but the extension comes after a dot
+			pattern.WriteString(`\..+`)
+		case segment.token == tokenCreated && r.config.CounterScope == config.CounterScopeDay:
+			pattern.WriteString(regexp.QuoteMeta(s.cleanPart(values.created.Format(segment.arg))))
+		case segment.token == tokenCreated:
+			//any date, but shaped like one so it can't take in words around it
+			for _, c := range s.cleanPart(values.created.Format(segment.arg)) {
+				switch {
+				case unicode.IsDigit(c):
+					pattern.WriteString(`\d`)
+				case unicode.IsLetter(c):
+					pattern.WriteString(`\pL+`)
+				default:
+					pattern.WriteString(regexp.QuoteMeta(string(c)))
+				}
+			}
+		case segment.token == tokenWords && r.config.CounterScope == config.CounterScopeWords:
+			//scopes are keyed by the matched words, so tagged duplicates count along with them
+			token := &nameTemplate{segments: []templateSegment{segment}}
+			scoped := *values
+			scoped.words = values.matched
+			pattern.WriteString(regexp.QuoteMeta(joinParts(token.parts(&scoped, 0, s), "")))
+			if r.config.DuplicatePolicy == config.DuplicateTag {
+				pattern.WriteString("(?:" + regexp.QuoteMeta(s.cleanPart(values.sep)+duplicateMarker) + ")?")
+			}
+		default:
+			pattern.WriteString(wildcard)
+		}
+	}
+	pattern.WriteString("$")
+	return regexp.MustCompile(pattern.String())
+}
+
+//sortByCaptureDate orders files by the date they'll be named by, then by ID.
+//Files without a usable date go last, they'll fail to be named anyway
+func (r *Renamer) sortByCaptureDate(files []*fileretrieveriface.RenameInfo) {
+	dates := make(map[*fileretrieveriface.RenameInfo]time.Time, len(files))
+	for _, file := range files {
+		if date, _, err := r.captureDate(file); err == nil {
+			if parsed, err := time.Parse(time.RFC3339, date); err == nil {
+				dates[file] = parsed
+			}
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		di, iok := dates[files[i]]
+		dj, jok := dates[files[j]]
+		if iok != jok {
+			return iok
+		}
+		if !di.Equal(dj) {
+			return di.Before(dj)
+		}
+		return files[i].ID < files[j].ID
+	})
+}
+
+//stemWords returns everything that matched a persistent word, which is removed from kept stems
+func (r *Renamer) stemWords(matches *wordMatches) []string {
+	words := append([]string{}, r.config.PersistentWords...)
+	for _, aliases := range r.config.PersistentWordAliases {
+		words = append(words, aliases...)
+	}
+	for _, matchedBy := range matches.aliases {
+		words = append(words, matchedBy)
+	}
+	//longest first, so a word inside a longer alias doesn't leave part of the alias behind
+	sort.SliceStable(words, func(i, j int) bool {
+		return len(words[i]) > len(words[j])
+	})
+	return words
+}
+
+//nameTemplate returns the parsed name template from config, or the default
+//template when none is configured
+func (r *Renamer) nameTemplate() (*nameTemplate, error) {
+	if r.template == nil || r.template.source != r.config.NameTemplate {
+		source := r.config.NameTemplate
+		if source == "" {
+			source = defaultNameTemplate
+			if r.config.KeepStem {
+				source = keepStemNameTemplate
+			}
+		}
+		template, err := parseNameTemplate(source)
+		if err != nil {
+			return nil, err
+		}
+		template.source = r.config.NameTemplate
+		r.template = template
+	}
+	return r.template, nil
+}
+
+//wordMatches is everything found in a file name to keep in its new name
+type wordMatches struct {
+	//words holds the persistent words followed by the output of each matching rename rule
+	words []string
+	//groups holds the named groups captured by the rename rules
+	groups map[string]string
+	//aliases maps each persistent word matched by an alias, or fuzzily, to the text that matched
+	aliases map[string]string
+}
+
+//matchWords finds the persistent words in name followed by the output of each
+//matching rename rule, in config order, along with the named groups captured by the rules.
+//When rules capture a group with the same name, the first rule's value is kept
+func (r *Renamer) matchWords(name string) (*wordMatches, error) {
+	matches := &wordMatches{
+		groups:  make(map[string]string),
+		aliases: make(map[string]string),
+	}
+	for _, match := range r.matchPersistentWords(name) {
+		matches.words = append(matches.words, match.word)
+		if match.matchedBy != "" {
+			matches.aliases[match.word] = match.matchedBy
+		}
+	}
+
+	if r.rules == nil && len(r.config.RenameRules) > 0 {
+		rules, err := compileRenameRules(r.config.RenameRules)
+		if err != nil {
+			return nil, err
+		}
+		r.rules = rules
+	}
+	for _, rule := range r.rules {
+		output, captured, ok := rule.match(name)
+		if !ok {
+			continue
+		}
+		if output != "" {
+			matches.words = append(matches.words, output)
+		}
+		for group, value := range captured {
+			if _, ok := matches.groups[group]; !ok {
+				matches.groups[group] = value
+			}
+		}
 	}
-	return dupCheck, nil
+	return matches, nil
 }
 
 //a time format of YYYY_MMDD
@@ -1,6 +1,7 @@
 package fileactions
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -15,46 +16,48 @@ import (
 func TestFileActions(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "FileActions Suite")
+}
 
-	var _ = Describe("FileActions", func() {
-		mockRetriever := &fileretriever.MockFileRetriever{}
-		mockToday, _ := time.Parse(time.RFC3339, "2020-08-24T19:33:44.561Z")
-		fileAction := &Renamer{
-			logger:        &logger.MockLogger{},
-			fileRetriever: mockRetriever,
-			name:          "testfileaction",
-			config: &config.Config{
-				PersistentWords: []string{"foo", "bar"},
-				NameDelimiter:   "_",
-			},
-			processedFiles: map[string]bool{"2010_0111_0.mov": true},
-		}
-		Describe("generateNewName()", func() {
-			It("Should return a generated name with an incremented duplicate number", func() {
-				actual, err := fileAction.generateNewName("foogetsdeletedbar.mov", "2020-10-19T04:49:06.334Z")
-				expected := "foo_bar_2020_1019_1.mov"
-				Expect(err).To(BeNil())
-				Expect(fileAction.processedFiles["foo_bar_2020_1019_0.mov"]).To(Equal(true))
-				Expect(actual).To(Equal(expected))
-			})
+var _ = Describe("FileActions", func() {
+	mockRetriever := &fileretriever.MockFileRetriever{}
+	mockToday, _ := time.Parse(time.RFC3339, "2020-08-24T19:33:44.561Z")
+	fileAction := &Renamer{
+		logger:        &logger.MockLogger{},
+		fileRetriever: mockRetriever,
+		name:          "testfileaction",
+		config: &config.Config{
+			PersistentWords: []string{"foo", "bar"},
+			NameDelimiter:   "_",
+		},
+		processedFiles: map[string]bool{"foo_bar_2020_1019_0.mov": true},
+	}
+	Describe("generateNewName()", func() {
+		It("Should return a generated name with an incremented duplicate number", func() {
+			actual, err := fileAction.generateNewName("foogetsdeletedbar.mov", "2020-10-19T04:49:06.334Z")
+			expected := "foo_bar_2020_1019_1.mov"
+			Expect(err).To(BeNil())
+			Expect(fileAction.processedFiles["foo_bar_2020_1019_0.mov"]).To(Equal(true))
+			Expect(actual).To(Equal(expected))
 		})
+	})
 
-		Describe("parseRFC3339()", func() {
-			It("should return nothing when given an invalid timestamp", func() {
-				actual, err := fileAction.parseRFC3339("2020-03-24 04:45:20")
-				expected := ""
-				Expect(actual).To(Equal(expected))
-				Expect(err).ToNot(BeNil())
-			})
-			It("should return the format YYYY_MMDD when given a valid timestamp", func() {
-				actual, err := fileAction.parseRFC3339("2020-08-31T19:33:44.561Z")
-				expected := "2020_0831"
-				Expect(actual).To(Equal(expected))
-				Expect(err).To(BeNil())
-			})
+	Describe("parseRFC3339()", func() {
+		It("should return nothing when given an invalid timestamp", func() {
+			actual, err := fileAction.parseRFC3339("2020-03-24 04:45:20")
+			expected := ""
+			Expect(actual).To(Equal(expected))
+			Expect(err).ToNot(BeNil())
+		})
+		It("should return the format YYYY_MMDD when given a valid timestamp", func() {
+			actual, err := fileAction.parseRFC3339("2020-08-31T19:33:44.561Z")
+			expected := "2020_0831"
+			Expect(actual).To(Equal(expected))
+			Expect(err).To(BeNil())
 		})
+	})
 
-		Describe("Run()", func() {
+	Describe("Run()", func() {
+		It("should rename every file and number the ones sharing a name", func() {
 			mockFileInfo := []*fileretrieveriface.RenameInfo{
 				{
 					ID:          "11111111",
@@ -78,18 +81,20 @@ func TestFileActions(t *testing.T) {
 				},
 			}
 			mockRetriever.On("GetFileInfo").Return(mockFileInfo, nil)
+			mockRetriever.On("GetExistingFiles").Return(mockFileInfo, nil)
 
 			processedFiles := map[string]bool{"2020_0828_0.mov": true}
 
+			defer func(saved func() time.Time) { now = saved }(now)
 			now = func() time.Time { return mockToday }
 
 			mockRetriever.On("GetProcessedFiles").Return(processedFiles)
 
 			updatedFiles := []*fileretrieveriface.RenameInfo {
-				{ID:"11111111", Name:"foo_2020_0831_0.mov", CreatedDate:"2020-08-31T19:33:44.561Z"},
-				{ID:"22222222", Name:"foo_2020_0831_1.mov", CreatedDate:"2020-08-31T19:33:44.561Z"},
-				{ID:"33333333", Name:"foo_bar_2020_0831_0.mov", CreatedDate:"2020-08-31T17:33:44.561Z"},
-				{ID:"44444444", Name:"2020_0828_1.mov", CreatedDate:"2020-08-28T19:33:44.561Z"},				
+				{ID:"11111111", Name:"foo_2020_0831_0.mov", CreatedDate:"2020-08-31T19:33:44.561Z", OriginalName:"foofile1.mov", DateSource:"createdDate"},
+				{ID:"22222222", Name:"foo_2020_0831_1.mov", CreatedDate:"2020-08-31T19:33:44.561Z", OriginalName:"foofile1.mov", DateSource:"createdDate"},
+				{ID:"33333333", Name:"foo_bar_2020_0831_0.mov", CreatedDate:"2020-08-31T17:33:44.561Z", OriginalName:"foobarfile2.mov", DateSource:"createdDate"},
+				{ID:"44444444", Name:"2020_0828_1.mov", CreatedDate:"2020-08-28T19:33:44.561Z", OriginalName:"file3.mov", DateSource:"createdDate"},				
 			}
 
 			mockRetriever.On("UpdateFile", updatedFiles[0]).Return(nil)
@@ -97,13 +102,13 @@ func TestFileActions(t *testing.T) {
 			mockRetriever.On("UpdateFile", updatedFiles[2]).Return(nil)
 			mockRetriever.On("UpdateFile", updatedFiles[3]).Return(nil)
 
-			fileAction.Run()
+			Expect(fileAction.Run(context.Background())).To(Succeed())
 
-			mockRetriever.AssertExpectations(t)
+			mockRetriever.AssertExpectations(GinkgoT())
 
 			//Check that processedFiles were updated
 			Expect(fileAction.processedFiles).NotTo(Equal("2010_0111_0.mov"))
+			Expect(fileAction.processedFiles).To(HaveKey("foo_2020_0831_1.mov"))
 		})
 	})
-
-}
+})
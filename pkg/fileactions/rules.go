@@ -0,0 +1,80 @@
+package fileactions
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/davidparks11/file-renamer/pkg/config"
+)
+
+//renameRule is a config.RenameRule with its pattern compiled
+type renameRule struct {
+	config.RenameRule
+	pattern *regexp.Regexp
+}
+
+func compileRenameRules(rules []config.RenameRule) ([]*renameRule, error) {
+	var compiled []*renameRule
+	for _, rule := range rules {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, &renameRule{RenameRule: rule, pattern: pattern})
+	}
+	return compiled, nil
+}
+
+//match returns what the rule keeps from name along with the named groups it captured,
+//or false if the rule doesn't match. Only the first match is used
+func (r *renameRule) match(name string) (string, map[string]string, bool) {
+	for _, loc := range r.pattern.FindAllStringSubmatchIndex(name, -1) {
+		if loc[0] == loc[1] || (r.WholeWord && !isWholeWord(name, loc[0], loc[1])) {
+			continue
+		}
+
+		output := name[loc[0]:loc[1]]
+		if r.Output != "" {
+			output = string(r.pattern.ExpandString(nil, r.Output, name, loc))
+		}
+		groups := make(map[string]string)
+		for i, group := range r.pattern.SubexpNames() {
+			if group != "" && loc[2*i] >= 0 {
+				groups[group] = applyCase(name[loc[2*i]:loc[2*i+1]], r.Case)
+			}
+		}
+		return applyCase(output, r.Case), groups, true
+	}
+	return "", nil, false
+}
+
+//isWholeWord returns true if name[start:end] isn't touching a letter or digit on either side
+func isWholeWord(name string, start int, end int) bool {
+	before, _ := utf8.DecodeLastRuneInString(name[:start])
+	after, _ := utf8.DecodeRuneInString(name[end:])
+	return !isWordRune(before) && !isWordRune(after)
+}
+
+func isWordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+func applyCase(text string, textCase string) string {
+	switch textCase {
+	case config.CaseLower:
+		return strings.ToLower(text)
+	case config.CaseUpper:
+		return strings.ToUpper(text)
+	case config.CaseTitle:
+		runes := []rune(strings.ToLower(text))
+		for i := range runes {
+			if i == 0 || !isWordRune(runes[i-1]) {
+				runes[i] = unicode.ToUpper(runes[i])
+			}
+		}
+		return string(runes)
+	}
+	return text
+}
@@ -0,0 +1,58 @@
+package fileactions
+
+import (
+	"github.com/davidparks11/file-renamer/pkg/config"
+	"github.com/davidparks11/file-renamer/pkg/logger"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rename rules", func() {
+	newRenamer := func(cfg *config.Config) *Renamer {
+		return NewProcess(&logger.MockLogger{}, nil, nil, cfg).(*Renamer)
+	}
+
+	Describe("matchWords()", func() {
+		It("should keep persistent words as substring matches before rule output", func() {
+			renamer := newRenamer(&config.Config{
+				PersistentWords: []string{"art"},
+				RenameRules: []config.RenameRule{
+					{Pattern: "(?i)art", Case: config.CaseUpper, WholeWord: true},
+				},
+			})
+			matches, err := renamer.matchWords("party.mov")
+			Expect(err).To(BeNil())
+			Expect(matches.words).To(Equal([]string{"art"}))
+
+			matches, err = renamer.matchWords("party_art.mov")
+			Expect(err).To(BeNil())
+			Expect(matches.words).To(Equal([]string{"art", "ART"}))
+		})
+
+		It("should fill the output from named groups in rule order", func() {
+			renamer := newRenamer(&config.Config{
+				RenameRules: []config.RenameRule{
+					{Pattern: `shoot[ _-]?(?P<shoot>\d+)`, Output: "S${shoot}"},
+					{Pattern: `(?i)client-(?P<client>[a-z]+ [a-z]+)`, Output: "${client}", Case: config.CaseTitle},
+					{Pattern: `nothing`},
+				},
+			})
+			matches, err := renamer.matchWords("client-acme corp shoot_042.mov")
+			Expect(err).To(BeNil())
+			Expect(matches.words).To(Equal([]string{"S042", "Acme Corp"}))
+			Expect(matches.groups).To(Equal(map[string]string{"shoot": "042", "client": "Acme Corp"}))
+		})
+	})
+
+	It("should put rule groups in the name with {group:name}", func() {
+		renamer := newRenamer(&config.Config{
+			NameDelimiter: "_",
+			NameTemplate:  "{group:client}{sep}{created:2006}{sep}{counter}{ext}",
+			RenameRules:   []config.RenameRule{{Pattern: `^(?P<client>[A-Z]{3})-`}},
+		})
+		name, err := renamer.generateNewName("ABC-raw.mov", "2020-08-31T19:33:44.561Z")
+		Expect(err).To(BeNil())
+		Expect(name).To(Equal("ABC_2020_0.mov"))
+	})
+})
@@ -0,0 +1,155 @@
+package fileactions
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/davidparks11/file-renamer/pkg/config"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	//defaultMaxNameLength is the longest name in bytes most file systems allow
+	defaultMaxNameLength = 255
+	//unsafeReplacement replaces characters a profile doesn't allow
+	unsafeReplacement = "_"
+)
+
+//windowsReserved are names windows won't create, whatever the extension
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+//transliterations are letters that don't become ascii by dropping their accents
+var transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE", 'ø': "o", 'Ø': "O",
+	'ł': "l", 'Ł': "L", 'đ': "d", 'Đ': "D", 'þ': "th", 'Þ': "TH", 'ð': "d", 'Ð': "D",
+}
+
+//sanitizer makes names safe for the file systems of the configured profile
+type sanitizer struct {
+	profile       string
+	transliterate bool
+	maxLength     int
+}
+
+func newSanitizer(cfg *config.Config) *sanitizer {
+	s := &sanitizer{
+		profile:       cfg.SanitizeProfile,
+		transliterate: cfg.Transliterate,
+		maxLength:     cfg.MaxNameLength,
+	}
+	if s.profile == "" {
+		s.profile = config.ProfilePosix
+	}
+	if s.maxLength <= 0 {
+		s.maxLength = defaultMaxNameLength
+	}
+	return s
+}
+
+//cleanPart normalizes text to NFC, transliterates it to ascii if configured, and
+//replaces characters the profile doesn't allow
+func (s *sanitizer) cleanPart(text string) string {
+	text = norm.NFC.String(text)
+	if s.transliterate {
+		text = toASCII(text)
+	}
+	var clean strings.Builder
+	for _, r := range text {
+		if s.allowed(r) {
+			clean.WriteRune(r)
+		} else {
+			clean.WriteString(unsafeReplacement)
+		}
+	}
+	return clean.String()
+}
+
+func (s *sanitizer) allowed(r rune) bool {
+	if r == '/' || r == 0 {
+		return false
+	}
+	windows := s.profile == config.ProfileWindows || s.profile == config.ProfilePortable
+	mac := s.profile == config.ProfileMacOS || s.profile == config.ProfilePortable
+	if mac && r == ':' {
+		return false
+	}
+	if windows && (r < 32 || strings.ContainsRune(`<>:"\|?*`, r)) {
+		return false
+	}
+	return true
+}
+
+//finish fixes what can only be seen in the whole name. Windows names can't end in a
+//dot or space or be a reserved device name
+func (s *sanitizer) finish(name string) string {
+	if s.profile != config.ProfileWindows && s.profile != config.ProfilePortable {
+		return name
+	}
+	name = strings.TrimRight(name, ". ")
+	base := name
+	if i := strings.Index(name, "."); i != -1 {
+		base = name[:i]
+	}
+	if windowsReserved[strings.ToUpper(base)] {
+		name = base + unsafeReplacement + name[len(base):]
+	}
+	return name
+}
+
+//toASCII drops accents and transliterates letters that have an ascii spelling.
+//Anything else outside ascii is dropped
+func toASCII(text string) string {
+	var ascii strings.Builder
+	for _, r := range norm.NFD.String(text) {
+		switch {
+		case r < utf8.RuneSelf:
+			ascii.WriteRune(r)
+		case unicode.Is(unicode.Mn, r):
+			//combining accent left over from decomposing
+		case transliterations[r] != "":
+			ascii.WriteString(transliterations[r])
+		}
+	}
+	return ascii.String()
+}
+
+//fit shortens the flexible parts of a name, longest first, until the joined name is
+//no longer than the max length. Fixed parts such as the date, counter and extension are kept whole
+func (s *sanitizer) fit(parts []namePart, sep string) string {
+	name := joinParts(parts, sep)
+	for len(name) > s.maxLength {
+		longest := -1
+		for i, part := range parts {
+			if !part.fixed && part.text != "" && (longest == -1 || len(part.text) > len(parts[longest].text)) {
+				longest = i
+			}
+		}
+		if longest == -1 {
+			//only fixed parts are left, nothing more can be cut
+			break
+		}
+		keep := len(parts[longest].text) - (len(name) - s.maxLength)
+		parts[longest].text = strings.TrimRight(truncateBytes(parts[longest].text, keep), " -_."+sep)
+		name = joinParts(parts, sep)
+	}
+	return s.finish(name)
+}
+
+//truncateBytes cuts text to at most n bytes without splitting a character
+func truncateBytes(text string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if len(text) <= n {
+		return text
+	}
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n]
+}
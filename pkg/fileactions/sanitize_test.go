@@ -0,0 +1,49 @@
+package fileactions
+
+import (
+	"strings"
+	"time"
+
+	"github.com/davidparks11/file-renamer/pkg/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("sanitizer", func() {
+	created, _ := time.Parse(time.RFC3339, "2020-08-31T19:33:44.561Z")
+	template, _ := parseNameTemplate(defaultNameTemplate)
+	render := func(cfg *config.Config, words ...string) string {
+		values := &nameValues{words: words, sep: "_", created: created, ext: ".mov"}
+		return template.renderSafe(values, 3, newSanitizer(cfg))
+	}
+
+	It("should only remove slashes by default", func() {
+		Expect(render(&config.Config{}, "a:b?", "c/d")).To(Equal("a:b?_c_d_2020_0831_3.mov"))
+	})
+
+	It("should follow the profile", func() {
+		Expect(render(&config.Config{SanitizeProfile: config.ProfileMacOS}, "a:b?")).To(Equal("a_b?_2020_0831_3.mov"))
+		Expect(render(&config.Config{SanitizeProfile: config.ProfileWindows}, `a:b?"c`)).To(Equal("a_b__c_2020_0831_3.mov"))
+	})
+
+	It("should normalize to NFC and transliterate when asked", func() {
+		decomposed := "Café"
+		Expect(render(&config.Config{}, decomposed)).To(Equal("Café_2020_0831_3.mov"))
+		Expect(render(&config.Config{Transliterate: true}, decomposed, "Straße", "東京")).To(Equal("Cafe_Strasse_2020_0831_3.mov"))
+	})
+
+	It("should fix reserved windows names and trailing dots", func() {
+		s := newSanitizer(&config.Config{SanitizeProfile: config.ProfilePortable})
+		Expect(s.finish("con.mov")).To(Equal("con_.mov"))
+		Expect(s.finish("LPT1")).To(Equal("LPT1_"))
+		Expect(s.finish("notes. ")).To(Equal("notes"))
+	})
+
+	It("should shorten the words but keep the date, counter and extension", func() {
+		name := render(&config.Config{MaxNameLength: 30}, strings.Repeat("a", 20), strings.Repeat("b", 20))
+		Expect(name).To(HaveLen(30))
+		Expect(name).To(HaveSuffix("_2020_0831_3.mov"))
+		Expect(name).To(Equal("aaaaaaaaaaaaaa_2020_0831_3.mov"))
+	})
+})
@@ -0,0 +1,63 @@
+package fileactions
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+//defaultStemMaxLength is the longest kept stem, in characters, when stemMaxLength isn't set
+const defaultStemMaxLength = 40
+
+//keepStemNameTemplate is the default template when keepStem is on, giving names of
+//the form <persistent words>_<original stem>_<YYYY_MMDD>_<n>.<ext>
+const keepStemNameTemplate = "{words}{sep}{cleanstem}{sep}{created:" + timeFormat + "}{sep}{counter}{ext}"
+
+//dateStamp matches dates commonly stamped into names, such as 2020_0831, 2020-08-31 and 20200831
+var dateStamp = regexp.MustCompile(`(?:19|20)\d{2}[-_. ]?(?:0[1-9]|1[0-2])[-_. ]?(?:0[1-9]|[12]\d|3[01])`)
+
+//stemJunk matches runs of anything that isn't a letter, digit or hyphen
+var stemJunk = regexp.MustCompile(`[^\p{L}\p{N}-]+`)
+
+//cleanStem returns the part of stem worth keeping in a new name. The words are removed
+//since they're already in the name, as are date stamps so the name isn't stamped twice.
+//What's left is joined with sep and cut to maxLength characters, at a word break if there is one
+func cleanStem(stem string, words []string, created time.Time, layouts []string, sep string, maxLength int) string {
+	for _, layout := range layouts {
+		if stamp := created.Format(layout); stamp != "" {
+			stem = strings.Replace(stem, stamp, " ", -1)
+		}
+	}
+	stem = dateStamp.ReplaceAllString(stem, " ")
+	for _, word := range words {
+		if word == "" {
+			continue
+		}
+		stem = regexp.MustCompile("(?i)"+regexp.QuoteMeta(word)).ReplaceAllString(stem, " ")
+	}
+
+	if sep == "" {
+		sep = "-"
+	}
+	var parts []string
+	for _, part := range stemJunk.Split(stem, -1) {
+		if part = strings.Trim(part, "-"); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	clean := strings.Join(parts, sep)
+
+	if maxLength <= 0 {
+		maxLength = defaultStemMaxLength
+	}
+	if utf8.RuneCountInString(clean) <= maxLength {
+		return clean
+	}
+	cut := string([]rune(clean)[:maxLength])
+	//end on a whole word unless that would throw away most of the stem
+	if i := strings.LastIndexAny(cut, sep+"-"); i >= len(cut)/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, sep+"-")
+}
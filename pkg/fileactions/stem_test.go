@@ -0,0 +1,43 @@
+package fileactions
+
+import (
+	"time"
+
+	"github.com/davidparks11/file-renamer/pkg/config"
+	"github.com/davidparks11/file-renamer/pkg/logger"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("cleanStem()", func() {
+	created, _ := time.Parse(time.RFC3339, "2020-08-31T19:33:44.561Z")
+	layouts := []string{timeFormat}
+
+	It("should keep descriptive names", func() {
+		Expect(cleanStem("bride-first-look", nil, created, layouts, "_", 0)).To(Equal("bride-first-look"))
+		Expect(cleanStem("bride first look (1)", nil, created, layouts, "_", 0)).To(Equal("bride_first_look_1"))
+	})
+
+	It("should remove persistent words and date stamps", func() {
+		Expect(cleanStem("Wedding_2020_0831_bride-first-look", []string{"wedding"}, created, layouts, "_", 0)).To(Equal("bride-first-look"))
+		Expect(cleanStem("IMG 2019-12-24 tree", nil, created, layouts, "_", 0)).To(Equal("IMG_tree"))
+		Expect(cleanStem("20200831", nil, created, layouts, "_", 0)).To(Equal(""))
+	})
+
+	It("should cut long stems at a word break", func() {
+		Expect(cleanStem("the-bride-and-groom-first-look", nil, created, layouts, "_", 20)).To(Equal("the-bride-and-groom"))
+		Expect(cleanStem("abcdefghijklmnopqrstuvwxyz", nil, created, layouts, "_", 10)).To(Equal("abcdefghij"))
+	})
+
+	It("should put the stem in names when keepStem is on", func() {
+		renamer := NewProcess(&logger.MockLogger{}, nil, nil, &config.Config{
+			NameDelimiter:   "_",
+			PersistentWords: []string{"wedding"},
+			KeepStem:        true,
+		}).(*Renamer)
+		name, err := renamer.generateNewName("wedding 2020_0831 bride-first-look.mov", "2020-08-31T19:33:44.561Z")
+		Expect(err).To(BeNil())
+		Expect(name).To(Equal("wedding_bride-first-look_2020_0831_0.mov"))
+	})
+})
@@ -0,0 +1,241 @@
+package fileactions
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	//defaultNameTemplate produces names of the form <persistent words>_<YYYY_MMDD>_<n>.<ext>
+	defaultNameTemplate = "{words}{sep}{created:" + timeFormat + "}{sep}{counter}{ext}"
+
+	tokenWords   = "words"
+	tokenSep     = "sep"
+	tokenCreated = "created"
+	tokenCounter = "counter"
+	tokenExt     = "ext"
+	tokenStem    = "stem"
+	tokenParent  = "parent"
+	tokenOwner   = "owner"
+	tokenMime    = "mime"
+	tokenGroup   = "group"
+	//tokenCleanStem is the original stem without persistent words or date stamps, see cleanStem
+	tokenCleanStem = "cleanstem"
+)
+
+//nameTemplate is a parsed name template such as
+//"{words}{sep}{created:2006-01-02}{sep}{counter:03}{ext}"
+type nameTemplate struct {
+	//source is the configured template this was parsed from
+	source   string
+	segments []templateSegment
+}
+
+//templateSegment is either literal text or a token with an optional argument
+type templateSegment struct {
+	literal string
+	token   string
+	arg     string
+}
+
+//nameValues holds everything a template can put in a name
+type nameValues struct {
+	words []string
+	//matched holds the words found in the name, without any marker added to words
+	matched   []string
+	groups    map[string]string
+	sep       string
+	created   time.Time
+	stem      string
+	cleanStem string
+	ext       string
+	parent    string
+	owner     string
+	mime      string
+}
+
+//parseNameTemplate parses a template. Every template needs a {counter} token,
+//otherwise there would be no way to tell duplicates apart
+func parseNameTemplate(template string) (*nameTemplate, error) {
+	t, err := parseTemplate("name", template)
+	if err != nil {
+		return nil, err
+	}
+	if !t.hasToken(tokenCounter) {
+		return nil, fmt.Errorf("name template %q has no {counter} token", template)
+	}
+	return t, nil
+}
+
+//parseTemplate parses the tokens of a template, kind names the template in errors
+func parseTemplate(kind string, template string) (*nameTemplate, error) {
+	t := &nameTemplate{}
+	rest := template
+	for rest != "" {
+		open := strings.Index(rest, "{")
+		if open == -1 {
+			t.segments = append(t.segments, templateSegment{literal: rest})
+			break
+		}
+		if open > 0 {
+			t.segments = append(t.segments, templateSegment{literal: rest[:open]})
+		}
+		end := strings.Index(rest[open:], "}")
+		if end == -1 {
+			return nil, fmt.Errorf("unclosed { in %s template %q", kind, template)
+		}
+		body := rest[open+1 : open+end]
+		rest = rest[open+end+1:]
+
+		segment := templateSegment{token: body}
+		if i := strings.Index(body, ":"); i != -1 {
+			segment.token, segment.arg = body[:i], body[i+1:]
+		}
+		switch segment.token {
+		case tokenCounter:
+			if segment.arg != "" {
+				if _, err := strconv.Atoi(segment.arg); err != nil {
+					return nil, fmt.Errorf("counter padding %q in %s template %q is not a number", segment.arg, kind, template)
+				}
+			}
+		case tokenCreated:
+			if segment.arg == "" {
+				segment.arg = timeFormat
+			}
+		case tokenGroup:
+			if segment.arg == "" {
+				return nil, fmt.Errorf("{group} in %s template %q needs the name of a rename rule group, such as {group:client}", kind, template)
+			}
+		case tokenWords, tokenSep, tokenExt, tokenStem, tokenCleanStem, tokenParent, tokenOwner, tokenMime:
+		default:
+			return nil, fmt.Errorf("unknown token {%s} in %s template %q", body, kind, template)
+		}
+		t.segments = append(t.segments, segment)
+	}
+	return t, nil
+}
+
+//createdLayouts returns the layout of every {created} token
+func (t *nameTemplate) createdLayouts() []string {
+	var layouts []string
+	for _, segment := range t.segments {
+		if segment.token == tokenCreated {
+			layouts = append(layouts, segment.arg)
+		}
+	}
+	return layouts
+}
+
+//hasToken returns true if the template uses token
+func (t *nameTemplate) hasToken(token string) bool {
+	for _, segment := range t.segments {
+		if segment.token == token {
+			return true
+		}
+	}
+	return false
+}
+
+//namePart is a non-empty part of a rendered name
+type namePart struct {
+	text string
+	//sepBefore is set if a {sep} came between this part and the one before it
+	sepBefore bool
+	//fixed parts, such as the date, counter and extension, are never shortened
+	fixed bool
+}
+
+//render builds a name from the template. A {sep} is only written between two
+//non-empty parts of the name, so empty tokens don't leave doubled separators
+func (t *nameTemplate) render(values *nameValues, counter int) string {
+	return joinParts(t.parts(values, counter, nil), values.sep)
+}
+
+//renderSafe builds a name like render, with each part cleaned by the sanitizer
+//and the name shortened to fit its max length
+func (t *nameTemplate) renderSafe(values *nameValues, counter int, s *sanitizer) string {
+	return s.fit(t.parts(values, counter, s), s.cleanPart(values.sep))
+}
+
+//parts fills the template, cleaning each part with s if it isn't nil
+func (t *nameTemplate) parts(values *nameValues, counter int, s *sanitizer) []namePart {
+	var parts []namePart
+	pendingSep := false
+	for _, segment := range t.segments {
+		if segment.token == tokenSep {
+			pendingSep = len(parts) > 0
+			continue
+		}
+		part := namePart{text: segment.literal, fixed: true}
+		if segment.token != "" {
+			part.text = values.value(segment, counter)
+			part.fixed = segment.token == tokenCreated || segment.token == tokenCounter || segment.token == tokenExt
+		}
+		if s != nil && segment.token == tokenWords {
+			//cleaned one at a time so a word cleaned away doesn't leave a doubled separator
+			var words []string
+			for _, word := range values.words {
+				if word = s.cleanPart(word); word != "" {
+					words = append(words, word)
+				}
+			}
+			part.text = strings.Join(words, s.cleanPart(values.sep))
+		} else if s != nil {
+			part.text = s.cleanPart(part.text)
+		}
+		if part.text == "" {
+			continue
+		}
+		part.sepBefore = pendingSep
+		pendingSep = false
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+//joinParts joins the non-empty parts, with sep where the template had a {sep}
+func joinParts(parts []namePart, sep string) string {
+	var name strings.Builder
+	for _, part := range parts {
+		if part.text == "" {
+			continue
+		}
+		if part.sepBefore && name.Len() > 0 {
+			name.WriteString(sep)
+		}
+		name.WriteString(part.text)
+	}
+	return name.String()
+}
+
+func (v *nameValues) value(segment templateSegment, counter int) string {
+	switch segment.token {
+	case tokenWords:
+		return strings.Join(v.words, v.sep)
+	case tokenCreated:
+		return v.created.Format(segment.arg)
+	case tokenCounter:
+		if segment.arg == "" {
+			return strconv.Itoa(counter)
+		}
+		width, _ := strconv.Atoi(segment.arg)
+		return fmt.Sprintf("%0*d", width, counter)
+	case tokenExt:
+		return v.ext
+	case tokenStem:
+		return v.stem
+	case tokenCleanStem:
+		return v.cleanStem
+	case tokenParent:
+		return v.parent
+	case tokenOwner:
+		return v.owner
+	case tokenMime:
+		return v.mime
+	case tokenGroup:
+		return v.groups[segment.arg]
+	}
+	return ""
+}
@@ -0,0 +1,50 @@
+package fileactions
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("nameTemplate", func() {
+	created, _ := time.Parse(time.RFC3339, "2020-08-31T19:33:44.561Z")
+	values := &nameValues{
+		words:   []string{"foo", "bar"},
+		sep:     "_",
+		created: created,
+		stem:    "foobarfile2",
+		ext:     ".mov",
+		parent:  "shoots",
+		mime:    "video/quicktime",
+	}
+
+	Describe("render()", func() {
+		It("should produce the legacy names with the default template", func() {
+			template, err := parseNameTemplate(defaultNameTemplate)
+			Expect(err).To(BeNil())
+			Expect(template.render(values, 2)).To(Equal("foo_bar_2020_0831_2.mov"))
+			Expect(template.render(&nameValues{sep: "_", created: created, ext: ".mov"}, 0)).To(Equal("2020_0831_0.mov"))
+		})
+		It("should fill custom layouts, padding and file tokens", func() {
+			template, err := parseNameTemplate("{parent}{sep}{created:2006-01-02}{sep}{stem}-{counter:03}{ext}")
+			Expect(err).To(BeNil())
+			Expect(template.render(values, 7)).To(Equal("shoots_2020-08-31_foobarfile2-007.mov"))
+		})
+	})
+
+	Describe("parseNameTemplate()", func() {
+		It("should reject unknown tokens", func() {
+			_, err := parseNameTemplate("{words}{nope}{counter}")
+			Expect(err).NotTo(BeNil())
+		})
+		It("should reject templates without a counter", func() {
+			_, err := parseNameTemplate("{words}{sep}{created}{ext}")
+			Expect(err).NotTo(BeNil())
+		})
+		It("should reject unclosed tokens", func() {
+			_, err := parseNameTemplate("{words}{counter")
+			Expect(err).NotTo(BeNil())
+		})
+	})
+})
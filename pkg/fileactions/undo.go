@@ -0,0 +1,121 @@
+package fileactions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/davidparks11/file-renamer/pkg/fileactions/fileactionsiface"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
+	"github.com/davidparks11/file-renamer/pkg/journal/journaliface"
+	"github.com/davidparks11/file-renamer/pkg/logger/loggeriface"
+)
+
+var _ fileactionsiface.Process = &Undo{}
+
+//Undo is a process that reverts renames recorded in the journal
+type Undo struct {
+	logger        loggeriface.Service
+	fileRetriever fileretrieveriface.FileRetriever
+	journal       journaliface.Journal
+	runID         string
+	fileID        string
+}
+
+//NewUndo returns a process that reverts every rename made by the run with runID,
+//or only the latest rename of the file with fileID when runID is empty
+func NewUndo(logger loggeriface.Service, fileRetriever fileretrieveriface.FileRetriever, journal journaliface.Journal, runID string, fileID string) fileactionsiface.Process {
+	return &Undo{
+		logger:        logger,
+		fileRetriever: fileRetriever,
+		journal:       journal,
+		runID:         runID,
+		fileID:        fileID,
+	}
+}
+
+//Run reverts the selected renames, newest first. Once ctx is done the file being
+//reverted is finished and the rest are left, so undo can be run again to revert them
+func (u *Undo) Run(ctx context.Context) error {
+	if u.runID == "" && u.fileID == "" {
+		return errors.New("a run ID or file ID is required to undo")
+	}
+	entries, err := u.journal.Entries()
+	if err != nil {
+		return err
+	}
+
+	renames := u.selectRenames(entries)
+	if len(renames) == 0 {
+		return errors.New("nothing to undo")
+	}
+
+	undoRunID := newRunID()
+	failed := 0
+	for i, rename := range renames {
+		if err = ctx.Err(); err != nil {
+			return fmt.Errorf("undo stopped after %d of %d files - %s", i, len(renames), err.Error())
+		}
+		//a file that was moved is moved back to where it was
+		info := &fileretrieveriface.RenameInfo{
+			ID:             rename.FileID,
+			Name:           rename.OldName,
+			ParentID:       rename.NewParentID,
+			TargetParentID: rename.OldParentID,
+		}
+		if err = u.fileRetriever.RevertFile(detach(ctx), info); err != nil {
+			u.logger.Error(fmt.Sprintf("Error reverting %s to %s - %s", rename.NewName, rename.OldName, err.Error()))
+			failed++
+			continue
+		}
+		u.logger.Info(fmt.Sprintf("Reverted %s to %s", rename.NewName, rename.OldName))
+
+		//recorded under the id of the rename so the rename is known to be undone,
+		//even if reverting changed the id
+		err = u.journal.Record(&journaliface.Entry{
+			Action:      journaliface.ActionUndo,
+			RunID:       undoRunID,
+			FileID:      rename.FileID,
+			OldName:     rename.NewName,
+			NewName:     rename.OldName,
+			Timestamp:   now(),
+			Job:         rename.Job,
+			OldParentID: rename.NewParentID,
+			NewParentID: rename.OldParentID,
+		})
+		if err != nil {
+			u.logger.Error(fmt.Sprintf("Error recording undo of %s in journal - %s", info.ID, err.Error()))
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to revert %d of %d files", failed, len(renames))
+	}
+	return nil
+}
+
+//selectRenames returns the renames matching the run or file that have not
+//already been undone, newest first
+func (u *Undo) selectRenames(entries []*journaliface.Entry) []*journaliface.Entry {
+	//a file whose latest entry is an undo has nothing left to revert
+	latest := make(map[string]*journaliface.Entry)
+	for _, entry := range entries {
+		latest[entry.FileID] = entry
+	}
+
+	var renames []*journaliface.Entry
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.Action != journaliface.ActionRename || latest[entry.FileID] != entry {
+			continue
+		}
+		if u.runID != "" && entry.RunID != u.runID {
+			continue
+		}
+		if u.fileID != "" && entry.FileID != u.fileID {
+			continue
+		}
+		renames = append(renames, entry)
+	}
+	return renames
+}
@@ -0,0 +1,58 @@
+package fileactions
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/davidparks11/file-renamer/pkg/fileretriever"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
+	"github.com/davidparks11/file-renamer/pkg/journal"
+	"github.com/davidparks11/file-renamer/pkg/journal/journaliface"
+	"github.com/davidparks11/file-renamer/pkg/logger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Undo", func() {
+	var dir string
+	var renameJournal journaliface.Journal
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "undo")
+		Expect(err).To(BeNil())
+		renameJournal = journal.NewJournal(filepath.Join(dir, "journal.jsonl"))
+		for _, entry := range []*journaliface.Entry{
+			{Action: journaliface.ActionRename, RunID: "run1", FileID: "11111111", OldName: "foofile1.mov", NewName: "foo_2020_0831_0.mov"},
+			{Action: journaliface.ActionRename, RunID: "run1", FileID: "22222222", OldName: "file2.mov", NewName: "2020_0831_0.mov"},
+			{Action: journaliface.ActionRename, RunID: "run2", FileID: "33333333", OldName: "file3.mov", NewName: "2020_0901_0.mov"},
+			{Action: journaliface.ActionUndo, RunID: "run3", FileID: "22222222", OldName: "2020_0831_0.mov", NewName: "file2.mov"},
+		} {
+			Expect(renameJournal.Record(entry)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should revert the renames of a run that have not been undone", func() {
+		mockRetriever := &fileretriever.MockFileRetriever{}
+		mockRetriever.On("RevertFile", &fileretrieveriface.RenameInfo{ID: "11111111", Name: "foofile1.mov"}).Return(nil)
+
+		Expect(NewUndo(&logger.MockLogger{}, mockRetriever, renameJournal, "run1", "").Run(context.Background())).To(Succeed())
+		mockRetriever.AssertNumberOfCalls(GinkgoT(), "RevertFile", 1)
+
+		entries, err := renameJournal.Entries()
+		Expect(err).To(BeNil())
+		Expect(entries[len(entries)-1].Action).To(Equal(journaliface.ActionUndo))
+		Expect(entries[len(entries)-1].FileID).To(Equal("11111111"))
+	})
+
+	It("should fail when there is nothing to undo", func() {
+		mockRetriever := &fileretriever.MockFileRetriever{}
+		Expect(NewUndo(&logger.MockLogger{}, mockRetriever, renameJournal, "", "22222222").Run(context.Background())).NotTo(Succeed())
+	})
+})
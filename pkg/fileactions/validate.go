@@ -0,0 +1,54 @@
+package fileactions
+
+import (
+	"fmt"
+
+	"github.com/davidparks11/file-renamer/pkg/config"
+)
+
+//ValidateConfig checks the parts of the config that only the renamer understands
+func ValidateConfig(cfg *config.Config) []config.Problem {
+	if len(cfg.Jobs) == 0 {
+		return validateJob(cfg, "")
+	}
+	var problems []config.Problem
+	for i, job := range cfg.Jobs {
+		problems = append(problems, validateJob(job, fmt.Sprintf("jobs[%d].", i))...)
+	}
+	return problems
+}
+
+func validateJob(cfg *config.Config, prefix string) []config.Problem {
+	var problems []config.Problem
+	if cfg.NameTemplate != "" {
+		template, err := parseNameTemplate(cfg.NameTemplate)
+		if err != nil {
+			problems = append(problems, config.Problem{Field: prefix + "nameTemplate", Message: err.Error()})
+		} else if cfg.KeepStem && !template.hasToken(tokenCleanStem) {
+			problems = append(problems, config.Problem{
+				Field:   prefix + "keepStem",
+				Message: "needs a {" + tokenCleanStem + "} token in nameTemplate to put the stem in",
+			})
+		}
+	}
+	if cfg.PairByStem && cfg.NameTemplate != "" {
+		if template, err := parseNameTemplate(cfg.NameTemplate); err == nil && !template.hasToken(tokenExt) {
+			problems = append(problems, config.Problem{
+				Field:   prefix + "pairByStem",
+				Message: "needs an {" + tokenExt + "} token in nameTemplate to tell paired files apart",
+			})
+		}
+	}
+	if cfg.FolderTemplate != "" {
+		if _, err := parseFolderTemplate(cfg.FolderTemplate); err != nil {
+			problems = append(problems, config.Problem{Field: prefix + "folderTemplate", Message: err.Error()})
+		}
+	}
+	if !isPlanFormat(cfg.PlanFormat) {
+		problems = append(problems, config.Problem{
+			Field:   prefix + "planFormat",
+			Message: fmt.Sprintf("%q must be %s, %s or %s", cfg.PlanFormat, PlanFormatTable, PlanFormatJSON, PlanFormatCSV),
+		})
+	}
+	return problems
+}
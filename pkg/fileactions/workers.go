@@ -0,0 +1,89 @@
+package fileactions
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//runWorkers runs tasks on a pool of updateWorkers goroutines and returns once they're all
+//done. The workers share the retriever's write limiter, so the pool only lets updates
+//overlap while they wait on drive, it never makes more calls than the limits allow.
+//Once ctx is done no more tasks are started, the ones running are finished. The number
+//of tasks started is returned
+func (r *Renamer) runWorkers(ctx context.Context, tasks []func(context.Context)) int {
+	finishing := detach(ctx)
+	workers := minInt(r.config.UpdateWorkers, len(tasks))
+	if workers <= 1 {
+		for i, task := range tasks {
+			if ctx.Err() != nil {
+				return i
+			}
+			task(finishing)
+		}
+		return len(tasks)
+	}
+
+	queue := make(chan func(context.Context))
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for task := range queue {
+				task(finishing)
+			}
+		}()
+	}
+	started := 0
+	for _, task := range tasks {
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case queue <- task:
+			started++
+		case <-ctx.Done():
+		}
+	}
+	close(queue)
+	wg.Wait()
+	return started
+}
+
+//detachedContext keeps the values of a context but not its cancellation, so the
+//file being updated when a run is stopped is finished instead of left half done
+type detachedContext struct {
+	context.Context
+}
+
+//detach returns a context that is never done, with the values of ctx
+func detach(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+//withRunTimeout bounds ctx by runTimeout, if it's set
+func (r *Renamer) withRunTimeout(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	if r.config.RunTimeout == "" {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, nil
+	}
+	timeout, err := time.ParseDuration(r.config.RunTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, nil
+}
@@ -0,0 +1,127 @@
+package fileactions
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/davidparks11/file-renamer/pkg/config"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
+	"github.com/davidparks11/file-renamer/pkg/logger"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ = Describe("Workers", func() {
+	It("should give files the same names however many workers update them", func() {
+		rename := func(workers int) []string {
+			var files []*fileretrieveriface.RenameInfo
+			for i := 0; i < 20; i++ {
+				files = append(files, &fileretrieveriface.RenameInfo{
+					ID:          fmt.Sprintf("%02d", i),
+					Name:        "foo.mov",
+					CreatedDate: fmt.Sprintf("2020-08-31T19:%02d:00Z", 20-i),
+				})
+			}
+			mockRetriever := &fileretriever.MockFileRetriever{}
+			mockRetriever.On("GetFileInfo").Return(files, nil)
+			mockRetriever.On("GetExistingFiles").Return(files, nil)
+			mockRetriever.On("GetProcessedFiles").Return(map[string]bool{})
+			mockRetriever.On("UpdateFile", mock.Anything).Return(nil)
+
+			renamer := NewProcess(&logger.MockLogger{}, mockRetriever, nil, &config.Config{
+				PersistentWords: []string{"foo"},
+				NameDelimiter:   "_",
+				UpdateWorkers:   workers,
+			})
+			Expect(renamer.Run(context.Background())).To(Succeed())
+			mockRetriever.AssertNumberOfCalls(GinkgoT(), "UpdateFile", len(files))
+
+			names := make([]string, len(files))
+			for i, file := range files {
+				names[i] = file.Name
+			}
+			return names
+		}
+
+		sequential := rename(1)
+		Expect(sequential).To(ContainElement("foo_2020_0831_19.mov"))
+		Expect(rename(8)).To(Equal(sequential))
+	})
+
+	It("should run up to updateWorkers updates at once", func() {
+		const workers = 4
+		var files []*fileretrieveriface.RenameInfo
+		for i := 0; i < 12; i++ {
+			files = append(files, &fileretrieveriface.RenameInfo{
+				ID:          fmt.Sprintf("%02d", i),
+				Name:        "foo.mov",
+				CreatedDate: "2020-08-31T19:00:00Z",
+			})
+		}
+		//each update blocks until workers updates are running together, or gives up after a while
+		var mu sync.Mutex
+		running, most := 0, 0
+		together := make(chan struct{})
+		mockRetriever := &fileretriever.MockFileRetriever{}
+		mockRetriever.On("GetFileInfo").Return(files, nil)
+		mockRetriever.On("GetExistingFiles").Return(files, nil)
+		mockRetriever.On("GetProcessedFiles").Return(map[string]bool{})
+		mockRetriever.On("UpdateFile", mock.Anything).Run(func(mock.Arguments) {
+			mu.Lock()
+			running++
+			if running > most {
+				most = running
+			}
+			if running == workers && most == workers {
+				close(together)
+			}
+			mu.Unlock()
+			select {
+			case <-together:
+			case <-time.After(5 * time.Second):
+			}
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}).Return(nil)
+
+		renamer := NewProcess(&logger.MockLogger{}, mockRetriever, nil, &config.Config{
+			PersistentWords: []string{"foo"},
+			NameDelimiter:   "_",
+			UpdateWorkers:   workers,
+		})
+		Expect(renamer.Run(context.Background())).To(Succeed())
+		mockRetriever.AssertNumberOfCalls(GinkgoT(), "UpdateFile", len(files))
+		Expect(most).To(Equal(workers))
+	})
+
+	It("should finish the file it's on and stop once the context is done", func() {
+		files := []*fileretrieveriface.RenameInfo{
+			{ID: "a", Name: "foo.mov", CreatedDate: "2020-08-31T19:00:00Z"},
+			{ID: "b", Name: "foo.mov", CreatedDate: "2020-08-31T20:00:00Z"},
+			{ID: "c", Name: "foo.mov", CreatedDate: "2020-08-31T21:00:00Z"},
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		mockRetriever := &fileretriever.MockFileRetriever{}
+		mockRetriever.On("GetFileInfo").Return(files, nil)
+		mockRetriever.On("GetExistingFiles").Return(files, nil)
+		mockRetriever.On("GetProcessedFiles").Return(map[string]bool{})
+		mockRetriever.On("UpdateFile", mock.Anything).Run(func(mock.Arguments) { cancel() }).Return(nil)
+
+		renamer := NewProcess(&logger.MockLogger{}, mockRetriever, nil, &config.Config{
+			PersistentWords: []string{"foo"},
+			NameDelimiter:   "_",
+		})
+		err := renamer.Run(ctx)
+
+		Expect(err).To(MatchError(ContainSubstring("run stopped after 1 of 3 planned changes")))
+		mockRetriever.AssertNumberOfCalls(GinkgoT(), "UpdateFile", 1)
+		Expect(files[0].Name).To(Equal("foo_2020_0831_0.mov"))
+		Expect(files[1].Name).To(Equal("foo.mov"))
+	})
+})
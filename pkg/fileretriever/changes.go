@@ -0,0 +1,379 @@
+package fileretriever
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
+	"google.golang.org/api/drive/v2"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	//defaultChangesStatePath the location written if the changes state path is not edited in config.json
+	defaultChangesStatePath = "file_renamer_changes.json"
+	folderMimeType          = "application/vnd.google-apps.folder"
+)
+
+//changesState is what's kept between runs to only look at files changed since the last run
+type changesState struct {
+	//ParentDirID is the folder the state was built for. The state is thrown away if it changes
+	ParentDirID string `json:"parentDirID"`
+	//DestinationFolderID is the destination the state was built for, it's searched along with ParentDirID
+	DestinationFolderID string `json:"destinationFolderID,omitempty"`
+	PageToken           string `json:"pageToken"`
+	//Folders maps the id of every folder in the tree to its title
+	Folders map[string]string `json:"folders"`
+	//Processed maps the id of every processed file in the tree to its title
+	Processed map[string]string `json:"processed"`
+	//Pending holds the ids of files returned by the last run that haven't been updated yet,
+	//they are fetched again on the next run since their changes have already been consumed
+	Pending []string `json:"pending"`
+}
+
+func (f *FileRetriever) changesStatePath() string {
+	if f.config.ChangesStatePath == "" {
+		return defaultChangesStatePath
+	}
+	return f.config.ChangesStatePath
+}
+
+func (f *FileRetriever) loadChangesState() (*changesState, error) {
+	b, err := ioutil.ReadFile(f.changesStatePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &changesState{}
+	if err = json.Unmarshal(b, state); err != nil {
+		return nil, err
+	}
+	//without a complete processed cache there is nothing to check new names against
+	if state.ParentDirID != f.config.ParentDirID || state.DestinationFolderID != f.config.DestinationFolderID || state.PageToken == "" || state.Folders == nil || state.Processed == nil {
+		return nil, nil
+	}
+	//a tree built with the quarantine in it holds its subfolders too, only a full scan drops them
+	if _, ok := state.Folders[f.config.QuarantineFolderID]; ok && f.isQuarantine(f.config.QuarantineFolderID) {
+		return nil, nil
+	}
+	return state, nil
+}
+
+//saveChangesState writes the state through a temp file so a crash can't truncate it
+func (f *FileRetriever) saveChangesState() error {
+	b, err := json.MarshalIndent(f.changes, "", "\t")
+	if err != nil {
+		return err
+	}
+	path := f.changesStatePath()
+	if err = ioutil.WriteFile(path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+//getChangedFileInfo returns the unprocessed files added or modified since the last run.
+//It returns false if there is no usable page token and a full scan is needed
+func (f *FileRetriever) getChangedFileInfo(ctx context.Context) ([]*fileretrieveriface.RenameInfo, bool, error) {
+	state, err := f.loadChangesState()
+	if err != nil {
+		f.logger.Warn("Unable to read changes state, doing a full scan: " + err.Error())
+		return nil, false, nil
+	}
+	if state == nil {
+		return nil, false, nil
+	}
+	f.changes = state
+
+	//files are collected by id so a file changed several times is only returned once
+	changed := make(map[string]*drive.File)
+	pageToken := state.PageToken
+	newStartPageToken := ""
+	reshaped := false
+	for pageToken != "" {
+		var changeList *drive.ChangeList
+		err := f.retry(ctx, "list changes", func() error {
+			if err := f.readLimiter.Wait(ctx); err != nil {
+				return err
+			}
+			var err error
+			changeList, err = f.drive.Changes.List().
+				PageToken(pageToken).
+				IncludeDeleted(true).
+				MaxResults(1000).
+				Context(ctx).
+				Do()
+			return err
+		})
+		if isInvalidToken(err) {
+			f.logger.Warn("Changes page token is no longer valid, doing a full scan: " + err.Error())
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, true, err
+		}
+		for _, change := range changeList.Items {
+			if f.applyChange(change, changed) {
+				reshaped = true
+			}
+		}
+		pageToken = changeList.NextPageToken
+		newStartPageToken = changeList.NewStartPageToken
+	}
+	//what's inside a folder moved in or out has no changes of its own to show up in
+	if reshaped {
+		f.logger.Info("A folder moved into or out of the tree, doing a full scan")
+		return nil, false, nil
+	}
+
+	//files returned last time but not updated have no new change to show up in
+	for _, id := range state.Pending {
+		if _, ok := changed[id]; ok {
+			continue
+		}
+		var file *drive.File
+		err := f.retry(ctx, "get pending file", func() error {
+			if err := f.readLimiter.Wait(ctx); err != nil {
+				return err
+			}
+			var err error
+			file, err = f.drive.Files.Get(id).Context(ctx).Do()
+			return err
+		})
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, true, err
+		}
+		changed[id] = file
+	}
+
+	//the folder names are needed to give each file its parent
+	f.useFolders(state.Folders)
+	var files []*fileretrieveriface.RenameInfo
+	state.Pending = nil
+	for id, file := range changed {
+		if !f.isRenameCandidate(file) {
+			continue
+		}
+		files = append(files, f.renameInfo(file))
+		state.Pending = append(state.Pending, id)
+	}
+	sort.Strings(state.Pending)
+	state.PageToken = newStartPageToken
+
+	if err = f.saveChangesState(); err != nil {
+		return nil, true, err
+	}
+	f.logger.Info(fmt.Sprintf("Found %d changed files", len(files)))
+	return files, true, nil
+}
+
+//applyChange updates the folder and processed caches from a change, and records
+//the changed file if it isn't a folder. It returns true when a folder other than a root
+//enters or leaves the tree, since the files and folders inside it are only found by a full scan
+func (f *FileRetriever) applyChange(change *drive.Change, changed map[string]*drive.File) bool {
+	state := f.changes
+	file := change.File
+	_, wasFolder := state.Folders[change.FileId]
+	if change.Deleted || file == nil || (file.Labels != nil && file.Labels.Trashed) {
+		delete(state.Folders, change.FileId)
+		delete(state.Processed, change.FileId)
+		delete(changed, change.FileId)
+		return wasFolder && !f.isRoot(change.FileId)
+	}
+
+	inTree := false
+	for _, parent := range file.Parents {
+		if _, ok := state.Folders[parent.Id]; ok {
+			inTree = true
+			break
+		}
+	}
+	if f.isQuarantine(file.Id) {
+		inTree = false
+	}
+
+	if file.MimeType == folderMimeType {
+		//the root folders stay in the tree even though their parents aren't
+		if f.isRoot(file.Id) {
+			state.Folders[file.Id] = file.Title
+			return false
+		}
+		if inTree {
+			state.Folders[file.Id] = file.Title
+		} else {
+			delete(state.Folders, file.Id)
+		}
+		return inTree != wasFolder
+	}
+
+	if !inTree {
+		delete(state.Processed, file.Id)
+		delete(changed, file.Id)
+		return false
+	}
+	if isProcessed(file) {
+		state.Processed[file.Id] = file.Title
+		delete(changed, file.Id)
+		return false
+	}
+	delete(state.Processed, file.Id)
+	changed[file.Id] = file
+	return false
+}
+
+//isRenameCandidate returns true for unprocessed, untrashed files in the folder tree
+//with a configured extension
+func (f *FileRetriever) isRenameCandidate(file *drive.File) bool {
+	if file.MimeType == folderMimeType || isProcessed(file) || (file.Labels != nil && file.Labels.Trashed) {
+		return false
+	}
+	inTree := false
+	for _, parent := range file.Parents {
+		if _, ok := f.changes.Folders[parent.Id]; ok {
+			inTree = true
+		}
+	}
+	if !inTree {
+		return false
+	}
+	title := strings.ToLower(file.Title)
+	for _, ext := range f.config.FileExtensions {
+		if strings.Contains(title, "."+strings.ToLower(ext)) {
+			return true
+		}
+	}
+	return false
+}
+
+//startChanges records the point to list changes from after a full scan. The token is
+//taken before the scan so changes made during the scan aren't missed
+func (f *FileRetriever) startChanges(ctx context.Context) (string, error) {
+	var startToken *drive.StartPageToken
+	err := f.retry(ctx, "get changes start token", func() error {
+		if err := f.readLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		var err error
+		startToken, err = f.drive.Changes.GetStartPageToken().Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return startToken.StartPageToken, nil
+}
+
+//finishFullScan saves the caches built by a full scan along with the start token
+func (f *FileRetriever) finishFullScan(pageToken string, files []*fileretrieveriface.RenameInfo) {
+	f.changes = &changesState{
+		ParentDirID:         f.config.ParentDirID,
+		DestinationFolderID: f.config.DestinationFolderID,
+		PageToken:           pageToken,
+		Folders:             f.folderNames,
+	}
+	for _, file := range files {
+		f.changes.Pending = append(f.changes.Pending, file.ID)
+	}
+	if err := f.saveChangesState(); err != nil {
+		f.logger.Error("Unable to save changes state: " + err.Error())
+	}
+}
+
+//cachedProcessedFiles returns the processed file titles kept in the changes state,
+//or nil if they haven't been listed since the last full scan
+func (f *FileRetriever) cachedProcessedFiles() map[string]bool {
+	f.changesMu.Lock()
+	defer f.changesMu.Unlock()
+	if f.changes == nil || f.changes.Processed == nil {
+		return nil
+	}
+	processedFiles := make(map[string]bool)
+	for _, title := range f.changes.Processed {
+		processedFiles[title] = true
+	}
+	return processedFiles
+}
+
+//cacheProcessedFiles stores the result of a full listing of processed files
+func (f *FileRetriever) cacheProcessedFiles(processed map[string]string) {
+	f.changesMu.Lock()
+	defer f.changesMu.Unlock()
+	if f.changes == nil {
+		return
+	}
+	f.changes.Processed = processed
+	if err := f.saveChangesState(); err != nil {
+		f.logger.Error("Unable to save changes state: " + err.Error())
+	}
+}
+
+//useFolders makes the cached folder tree the one queried for processed files and names
+func (f *FileRetriever) useFolders(folders map[string]string) {
+	f.folderNames = folders
+	f.queryableFolders = f.roots()
+	for id := range folders {
+		if !f.isRoot(id) {
+			f.queryableFolders = append(f.queryableFolders, id)
+		}
+	}
+}
+
+//isRoot returns true for the folders the tree is searched from
+func (f *FileRetriever) isRoot(id string) bool {
+	for _, root := range f.roots() {
+		if id == root {
+			return true
+		}
+	}
+	return false
+}
+
+//markUpdated moves an updated file from pending to processed in the changes state
+func (f *FileRetriever) markUpdated(info *fileretrieveriface.RenameInfo) {
+	f.changesMu.Lock()
+	defer f.changesMu.Unlock()
+	if f.changes == nil {
+		return
+	}
+	for i, id := range f.changes.Pending {
+		if id == info.ID {
+			f.changes.Pending = append(f.changes.Pending[:i], f.changes.Pending[i+1:]...)
+			break
+		}
+	}
+	if f.changes.Processed != nil {
+		f.changes.Processed[info.ID] = info.Name
+	}
+	if err := f.saveChangesState(); err != nil {
+		f.logger.Error("Unable to save changes state: " + err.Error())
+	}
+}
+
+func isProcessed(file *drive.File) bool {
+	for _, prop := range file.Properties {
+		if prop.Key == fileProcessedFlag && prop.Value == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+//isInvalidToken returns true when drive rejected the changes page token
+func isInvalidToken(err error) bool {
+	apiErr, ok := err.(*googleapi.Error)
+	if !ok {
+		return false
+	}
+	return apiErr.Code == http.StatusBadRequest || apiErr.Code == http.StatusNotFound || apiErr.Code == http.StatusGone
+}
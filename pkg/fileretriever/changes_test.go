@@ -0,0 +1,289 @@
+package fileretriever
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/davidparks11/file-renamer/pkg/config"
+	"github.com/davidparks11/file-renamer/pkg/logger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/drive/v2"
+)
+
+var _ = Describe("applyChange()", func() {
+	var retriever *FileRetriever
+	var changed map[string]*drive.File
+
+	parents := func(ids ...string) []*drive.ParentReference {
+		var refs []*drive.ParentReference
+		for _, id := range ids {
+			refs = append(refs, &drive.ParentReference{Id: id})
+		}
+		return refs
+	}
+
+	BeforeEach(func() {
+		retriever = &FileRetriever{
+			config: &config.Config{ParentDirID: "root", FileExtensions: []string{"mov"}},
+			changes: &changesState{
+				ParentDirID: "root",
+				Folders:     map[string]string{"root": "footage", "sub": "day1"},
+				Processed:   map[string]string{"done": "2020_0831_0.mov"},
+			},
+		}
+		changed = make(map[string]*drive.File)
+	})
+
+	It("should add new folders in the tree to the folder cache", func() {
+		retriever.applyChange(&drive.Change{FileId: "new", File: &drive.File{
+			Id: "new", Title: "day2", MimeType: folderMimeType, Parents: parents("root"),
+		}}, changed)
+		Expect(retriever.changes.Folders).To(HaveKeyWithValue("new", "day2"))
+		Expect(changed).To(BeEmpty())
+	})
+
+	It("should drop deleted folders and processed files", func() {
+		Expect(retriever.applyChange(&drive.Change{FileId: "sub", Deleted: true}, changed)).To(BeTrue())
+		Expect(retriever.applyChange(&drive.Change{FileId: "done", Deleted: true}, changed)).To(BeFalse())
+		Expect(retriever.changes.Folders).NotTo(HaveKey("sub"))
+		Expect(retriever.changes.Processed).NotTo(HaveKey("done"))
+	})
+
+	It("should ask for a full scan when a folder moves into or out of the tree", func() {
+		Expect(retriever.applyChange(&drive.Change{FileId: "sub", File: &drive.File{
+			Id: "sub", Title: "day1", MimeType: folderMimeType, Parents: parents("other"),
+		}}, changed)).To(BeTrue())
+		Expect(retriever.changes.Folders).NotTo(HaveKey("sub"))
+
+		Expect(retriever.applyChange(&drive.Change{FileId: "sub", File: &drive.File{
+			Id: "sub", Title: "day1", MimeType: folderMimeType, Parents: parents("root"),
+		}}, changed)).To(BeTrue())
+		Expect(retriever.applyChange(&drive.Change{FileId: "sub", File: &drive.File{
+			Id: "sub", Title: "day one", MimeType: folderMimeType, Parents: parents("root"),
+		}}, changed)).To(BeFalse())
+		Expect(retriever.changes.Folders).To(HaveKeyWithValue("sub", "day one"))
+	})
+
+	It("should collect unprocessed files in the tree as rename candidates", func() {
+		file := &drive.File{Id: "clip", Title: "foo.mov", Parents: parents("sub")}
+		retriever.applyChange(&drive.Change{FileId: "clip", File: file}, changed)
+		retriever.applyChange(&drive.Change{FileId: "elsewhere", File: &drive.File{
+			Id: "elsewhere", Title: "bar.mov", Parents: parents("other"),
+		}}, changed)
+		Expect(changed).To(HaveLen(1))
+		Expect(retriever.isRenameCandidate(file)).To(BeTrue())
+	})
+
+	It("should keep the quarantine folder out of the tree", func() {
+		retriever.config.DuplicatePolicy = config.DuplicateQuarantine
+		retriever.config.QuarantineFolderID = "dups"
+		Expect(retriever.applyChange(&drive.Change{FileId: "dups", File: &drive.File{
+			Id: "dups", Title: "dups", MimeType: folderMimeType, Parents: parents("root"),
+		}}, changed)).To(BeFalse())
+		retriever.applyChange(&drive.Change{FileId: "clip", File: &drive.File{
+			Id: "clip", Title: "foo.mov", Parents: parents("dups"),
+		}}, changed)
+		Expect(retriever.changes.Folders).NotTo(HaveKey("dups"))
+		Expect(changed).To(BeEmpty())
+	})
+
+	It("should cache processed files instead of renaming them", func() {
+		retriever.applyChange(&drive.Change{FileId: "clip", File: &drive.File{
+			Id: "clip", Title: "2020_0901_0.mov", Parents: parents("sub"),
+			Properties: []*drive.Property{{Key: fileProcessedFlag, Value: "true"}},
+		}}, changed)
+		Expect(changed).To(BeEmpty())
+		Expect(retriever.changes.Processed).To(HaveKeyWithValue("clip", "2020_0901_0.mov"))
+	})
+})
+
+var _ = Describe("GetFileInfo() with incremental sync", func() {
+	var (
+		dir       string
+		server    *httptest.Server
+		retriever *FileRetriever
+		//respond answers each drive call by its path and query
+		respond func(r *http.Request) (int, interface{})
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "changes")
+		Expect(err).To(BeNil())
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			code, body := respond(r)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(code)
+			json.NewEncoder(w).Encode(body)
+		}))
+		service, err := drive.New(server.Client())
+		Expect(err).To(BeNil())
+		service.BasePath = server.URL + "/"
+		retriever = &FileRetriever{
+			logger: &logger.MockLogger{},
+			config: &config.Config{
+				ParentDirID:      "root",
+				FileExtensions:   []string{"mov"},
+				IncrementalSync:  true,
+				ChangesStatePath: filepath.Join(dir, "changes.json"),
+			},
+			drive:        service,
+			readLimiter:  rate.NewLimiter(rate.Inf, 1),
+			writeLimiter: rate.NewLimiter(rate.Inf, 1),
+			retryPolicy:  &retryPolicy{maxAttempts: 1},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("should give changed files the folder they're in", func() {
+		retriever.changes = &changesState{
+			ParentDirID: "root",
+			PageToken:   "1",
+			Folders:     map[string]string{"root": "footage", "sub": "day1"},
+			Processed:   map[string]string{},
+		}
+		Expect(retriever.saveChangesState()).To(Succeed())
+		retriever.changes = nil
+		respond = func(r *http.Request) (int, interface{}) {
+			if r.URL.Path != "/changes" {
+				return http.StatusNotFound, nil
+			}
+			return http.StatusOK, &drive.ChangeList{
+				NewStartPageToken: "2",
+				Items: []*drive.Change{{FileId: "clip", File: &drive.File{
+					Id: "clip", Title: "foo.mov", Parents: []*drive.ParentReference{{Id: "sub"}},
+				}}},
+			}
+		}
+
+		files, err := retriever.GetFileInfo(context.Background())
+		Expect(err).To(BeNil())
+		Expect(files).To(HaveLen(1))
+		Expect(files[0].ParentID).To(Equal("sub"))
+		Expect(files[0].ParentName).To(Equal("day1"))
+	})
+
+	It("should do a full scan when a folder is moved into the tree", func() {
+		retriever.changes = &changesState{
+			ParentDirID: "root",
+			PageToken:   "1",
+			Folders:     map[string]string{"root": "footage"},
+			Processed:   map[string]string{},
+		}
+		Expect(retriever.saveChangesState()).To(Succeed())
+		retriever.changes = nil
+		respond = func(r *http.Request) (int, interface{}) {
+			query := r.URL.Query().Get("q")
+			switch {
+			case r.URL.Path == "/changes":
+				return http.StatusOK, &drive.ChangeList{
+					NewStartPageToken: "2",
+					Items: []*drive.Change{{FileId: "moved", File: &drive.File{
+						Id: "moved", Title: "day1", MimeType: folderMimeType, Parents: []*drive.ParentReference{{Id: "root"}},
+					}}},
+				}
+			case r.URL.Path == "/changes/startPageToken":
+				return http.StatusOK, &drive.StartPageToken{StartPageToken: "3"}
+			case r.URL.Path == "/files/root":
+				return http.StatusOK, &drive.File{Id: "root", Title: "footage"}
+			case strings.Contains(query, "'root' in parents") && strings.Contains(query, folderMimeType):
+				return http.StatusOK, &drive.FileList{Items: []*drive.File{{Id: "moved", Title: "day1", MimeType: folderMimeType}}}
+			case strings.Contains(query, folderMimeType):
+				return http.StatusOK, &drive.FileList{}
+			}
+			return http.StatusOK, &drive.FileList{Items: []*drive.File{{
+				Id: "clip", Title: "foo.mov", Parents: []*drive.ParentReference{{Id: "moved"}},
+			}}}
+		}
+
+		files, err := retriever.GetFileInfo(context.Background())
+		Expect(err).To(BeNil())
+		Expect(files).To(HaveLen(1))
+		Expect(files[0].ParentName).To(Equal("day1"))
+		Expect(retriever.changes.PageToken).To(Equal("3"))
+		Expect(retriever.changes.Folders).To(HaveKey("moved"))
+	})
+
+	It("should leave trashed files out of a full scan", func() {
+		respond = func(r *http.Request) (int, interface{}) {
+			query := r.URL.Query().Get("q")
+			switch {
+			case r.URL.Path == "/changes/startPageToken":
+				return http.StatusOK, &drive.StartPageToken{StartPageToken: "1"}
+			case r.URL.Path == "/files/root":
+				return http.StatusOK, &drive.File{Id: "root", Title: "footage"}
+			case strings.Contains(query, folderMimeType):
+				return http.StatusOK, &drive.FileList{}
+			}
+			files := []*drive.File{{Id: "live", Title: "foo.mov", Parents: []*drive.ParentReference{{Id: "root"}}}}
+			if !strings.Contains(query, "trashed = false") {
+				files = append(files, &drive.File{Id: "binned", Title: "bar.mov", Labels: &drive.FileLabels{Trashed: true}})
+			}
+			return http.StatusOK, &drive.FileList{Items: files}
+		}
+
+		files, err := retriever.GetFileInfo(context.Background())
+		Expect(err).To(BeNil())
+		Expect(files).To(HaveLen(1))
+		Expect(files[0].ID).To(Equal("live"))
+	})
+
+	It("should leave the quarantine folder and what's under it out of a full scan", func() {
+		retriever.config.DuplicatePolicy = config.DuplicateQuarantine
+		retriever.config.QuarantineFolderID = "dups"
+		respond = func(r *http.Request) (int, interface{}) {
+			query := r.URL.Query().Get("q")
+			switch {
+			case r.URL.Path == "/changes/startPageToken":
+				return http.StatusOK, &drive.StartPageToken{StartPageToken: "1"}
+			case r.URL.Path == "/files/root":
+				return http.StatusOK, &drive.File{Id: "root", Title: "footage"}
+			case strings.Contains(query, "'root' in parents") && strings.Contains(query, folderMimeType):
+				return http.StatusOK, &drive.FileList{Items: []*drive.File{
+					{Id: "sub", Title: "day1", MimeType: folderMimeType},
+					{Id: "dups", Title: "dups", MimeType: folderMimeType},
+				}}
+			case strings.Contains(query, folderMimeType):
+				return http.StatusOK, &drive.FileList{}
+			case strings.Contains(query, "'dups' in parents"):
+				return http.StatusBadRequest, map[string]interface{}{"error": map[string]interface{}{"code": 400, "message": "listed the quarantine"}}
+			}
+			return http.StatusOK, &drive.FileList{}
+		}
+
+		_, err := retriever.GetFileInfo(context.Background())
+		Expect(err).To(BeNil())
+		Expect(retriever.queryableFolders).To(ConsistOf("root", "sub"))
+		Expect(retriever.changes.Folders).NotTo(HaveKey("dups"))
+	})
+
+	It("should not record a full scan that failed to list every folder", func() {
+		respond = func(r *http.Request) (int, interface{}) {
+			switch {
+			case r.URL.Path == "/changes/startPageToken":
+				return http.StatusOK, &drive.StartPageToken{StartPageToken: "1"}
+			case r.URL.Path == "/files/root":
+				return http.StatusOK, &drive.File{Id: "root", Title: "footage"}
+			case strings.Contains(r.URL.Query().Get("q"), "mimeType = 'application/vnd.google-apps.folder'"):
+				return http.StatusOK, &drive.FileList{}
+			}
+			return http.StatusBadRequest, map[string]interface{}{"error": map[string]interface{}{"code": 400, "message": "bad query"}}
+		}
+
+		_, err := retriever.GetFileInfo(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("bad query")))
+		Expect(retriever.config.ChangesStatePath).NotTo(BeAnExistingFile())
+	})
+})
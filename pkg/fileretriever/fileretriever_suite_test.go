@@ -0,0 +1,13 @@
+package fileretriever
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestFileRetriever(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "FileRetriever Suite")
+}
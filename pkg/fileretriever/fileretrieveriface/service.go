@@ -1,14 +1,58 @@
 package fileretrieveriface
 
+import "context"
+
+const (
+	//DateSourceExif is the DateTimeOriginal exif tag read from the file itself
+	DateSourceExif = "exif"
+	//DateSourceImageMetadata is the capture time drive reads from image metadata
+	DateSourceImageMetadata = "imageMediaMetadata"
+	//DateSourceVideo is the creation time in the header of an mp4 or mov file
+	DateSourceVideo = "video"
+	//DateSourceCreated is the time the file was created, or uploaded to drive
+	DateSourceCreated = "createdDate"
+	//DateSourceModified is the time the file was last modified
+	DateSourceModified = "modifiedDate"
+)
+
 type RenameInfo struct {
 	ID 	 string
 	Name string
 	CreatedDate string
+	//OriginalName is the name the file had before it was renamed
+	OriginalName string
+	//ParentName is the name of the folder holding the file
+	ParentName string
+	//ParentID is the id of the folder holding the file
+	ParentID string
+	//TargetParentID is the id of the folder UpdateFile and RevertFile move the file to, the file stays where it is if empty
+	TargetParentID string
+	Owner string
+	MimeType string
+	//Dates holds RFC3339 dates keyed by the DateSource they were read from
+	Dates map[string]string
+	//DateSource is the source of the date used to name the file
+	DateSource string
+	//MD5Checksum is the hex md5 of the file content, empty when it isn't known
+	MD5Checksum string
+	//Size is the size of the file in bytes
+	Size int64
 }
 
+//FileRetriever finds files and makes changes to them. Every call stops early, returning
+//the context's error, once ctx is done
 type FileRetriever interface {
-	GetFileInfo() ([]*RenameInfo, error)
-	IsUniqueName(name string) bool
-	GetProcessedFiles() map[string]bool
-	UpdateFile(*RenameInfo) error
+	GetFileInfo(ctx context.Context) ([]*RenameInfo, error)
+	//GetExistingFiles returns every file under the parent folder, processed or not,
+	//after GetFileInfo has found the folders to look in
+	GetExistingFiles(ctx context.Context) ([]*RenameInfo, error)
+	GetProcessedFiles(ctx context.Context) map[string]bool
+	UpdateFile(ctx context.Context, info *RenameInfo) error
+	RevertFile(ctx context.Context, info *RenameInfo) error
+	//MoveFile moves the file into the folder with folderID
+	MoveFile(ctx context.Context, info *RenameInfo, folderID string) error
+	//TrashFile moves the file to the trash
+	TrashFile(ctx context.Context, info *RenameInfo) error
+	//FindOrCreateFolder returns the id of the folder called name in the folder with parentID, creating it if there isn't one
+	FindOrCreateFolder(ctx context.Context, parentID string, name string) (string, error)
 }
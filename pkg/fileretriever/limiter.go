@@ -0,0 +1,43 @@
+package fileretriever
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+//limiters holds the rate limiters of every file retriever so retrievers using the
+//same credentials share one quota. Keyed by credentials path and then "read"/"write"
+var limiters = struct {
+	sync.Mutex
+	byKey map[string]*rate.Limiter
+}{byKey: make(map[string]*rate.Limiter)}
+
+//sharedLimiter returns the limiter for the credentials and kind, creating it if needed.
+//An existing limiter takes the latest limit and burst, so a reloaded config applies to everyone.
+//Jobs sharing credentials are validated to give the same limits
+func sharedLimiter(credentialsPath string, kind string, perMinute int, burst int) *rate.Limiter {
+	if abs, err := filepath.Abs(credentialsPath); err == nil {
+		credentialsPath = abs
+	}
+	key := credentialsPath + "|" + kind
+	limit := rate.Every(time.Minute / time.Duration(perMinute))
+
+	limiters.Lock()
+	defer limiters.Unlock()
+	limiter, ok := limiters.byKey[key]
+	if !ok {
+		limiter = rate.NewLimiter(limit, burst)
+		limiters.byKey[key] = limiter
+		return limiter
+	}
+	if limiter.Limit() != limit {
+		limiter.SetLimit(limit)
+	}
+	if limiter.Burst() != burst {
+		limiter.SetBurst(burst)
+	}
+	return limiter
+}
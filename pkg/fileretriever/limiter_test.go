@@ -0,0 +1,104 @@
+package fileretriever
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
+	"github.com/davidparks11/file-renamer/pkg/logger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/drive/v2"
+)
+
+var _ = Describe("sharedLimiter()", func() {
+	var (
+		dir string
+		wd  string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "limiter")
+		Expect(err).To(BeNil())
+		wd, err = os.Getwd()
+		Expect(err).To(BeNil())
+		Expect(os.Chdir(dir)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.Chdir(wd)).To(Succeed())
+		os.RemoveAll(dir)
+	})
+
+	It("should share a limiter between retrievers using the same credentials", func() {
+		limiter := sharedLimiter("credentials.json", "read", 300, 1)
+		Expect(sharedLimiter(filepath.Join(dir, "credentials.json"), "read", 300, 1)).To(BeIdenticalTo(limiter))
+		Expect(sharedLimiter("credentials.json", "write", 300, 1)).NotTo(BeIdenticalTo(limiter))
+		Expect(sharedLimiter("other.json", "read", 300, 1)).NotTo(BeIdenticalTo(limiter))
+		Expect(limiter.Limit()).To(Equal(rate.Every(time.Minute / 300)))
+	})
+
+	It("should take the latest limits when they change", func() {
+		limiter := sharedLimiter("credentials.json", "write", 60, 1)
+		Expect(sharedLimiter("credentials.json", "write", 120, 5)).To(BeIdenticalTo(limiter))
+		Expect(limiter.Limit()).To(Equal(rate.Every(time.Minute / 120)))
+		Expect(limiter.Burst()).To(Equal(5))
+	})
+
+	It("should space the updates of concurrent workers by the shared write limiter", func() {
+		var mu sync.Mutex
+		var received []time.Time
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			received = append(received, time.Now())
+			mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(&drive.File{})
+		}))
+		defer server.Close()
+		service, err := drive.New(server.Client())
+		Expect(err).To(BeNil())
+		service.BasePath = server.URL + "/"
+
+		//two retrievers on the same credentials, like two jobs, share one write limiter
+		newRetriever := func() *FileRetriever {
+			return &FileRetriever{
+				logger:       &logger.MockLogger{},
+				drive:        service,
+				readLimiter:  rate.NewLimiter(rate.Inf, 1),
+				writeLimiter: sharedLimiter("credentials.json", "write", 1200, 1),
+				retryPolicy:  &retryPolicy{maxAttempts: 1},
+			}
+		}
+		retrievers := []*FileRetriever{newRetriever(), newRetriever()}
+		Expect(retrievers[0].writeLimiter).To(BeIdenticalTo(retrievers[1].writeLimiter))
+
+		const updates = 6
+		start := time.Now()
+		var wg sync.WaitGroup
+		for i := 0; i < updates; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				info := &fileretrieveriface.RenameInfo{ID: fmt.Sprint(i), Name: "foo.mov"}
+				Expect(retrievers[i%2].UpdateFile(context.Background(), info)).To(Succeed())
+			}(i)
+		}
+		wg.Wait()
+
+		//a burst of 1 at 1200 a minute lets one update through every 50ms
+		Expect(received).To(HaveLen(updates))
+		Expect(time.Since(start)).To(BeNumerically(">=", (updates-1)*50*time.Millisecond-5*time.Millisecond))
+	})
+})
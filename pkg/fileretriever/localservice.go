@@ -0,0 +1,512 @@
+package fileretriever
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidparks11/file-renamer/pkg/config"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
+	"github.com/davidparks11/file-renamer/pkg/logger/loggeriface"
+)
+
+const (
+	//defaultLocalStateFile is the sidecar written to the root of ParentDirID when
+	//localStatePath is not set in config.json
+	defaultLocalStateFile = ".file-renamer-state.json"
+)
+
+var _ fileretrieveriface.FileRetriever = &LocalFileRetriever{}
+
+//LocalFileRetriever gets files from a directory on disk and renames them in place.
+//File IDs are the paths of the files. The processed flag that drive keeps as a
+//file property is kept in a sidecar state file instead
+type LocalFileRetriever struct {
+	logger loggeriface.Service
+	config *config.Config
+	root   string
+	//destination is the directory files are moved under, when it isn't under root
+	destination string
+	statePath   string
+	mu          sync.Mutex
+	//processed holds the paths, relative to root, of every renamed file
+	processed map[string]bool
+	//hashes holds the content hash of every file hashed so far, by file ID
+	hashes map[string]*fileHash
+	//hashed is true when hashes has changed since the state file was written
+	hashed bool
+}
+
+//localState is the on disk format of the sidecar state file
+type localState struct {
+	Processed []string `json:"processed"`
+	//Hashes keeps the md5 of files between runs, so only new or changed files are read
+	Hashes map[string]*fileHash `json:"hashes,omitempty"`
+}
+
+//fileHash is the md5 of a file, along with the size and modification time it had when
+//it was hashed. The hash is only reused while both are the same
+type fileHash struct {
+	Size    int64  `json:"size"`
+	ModTime string `json:"modTime"`
+	MD5     string `json:"md5"`
+}
+
+//NewLocalFileRetriever serves a file retriever for the directory at config.ParentDirID
+func NewLocalFileRetriever(logger loggeriface.Service, config *config.Config) fileretrieveriface.FileRetriever {
+	root, err := filepath.Abs(config.ParentDirID)
+	if err != nil {
+		logger.Fatal("Unable to resolve parent directory: " + err.Error())
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		logger.Fatal("Parent directory " + root + " is not a readable directory")
+	}
+
+	statePath := config.LocalStatePath
+	if statePath == "" {
+		statePath = filepath.Join(root, defaultLocalStateFile)
+	}
+	//the walk compares absolute paths against it to leave the state file out
+	statePath, err = filepath.Abs(statePath)
+	if err != nil {
+		logger.Fatal("Unable to resolve local state path: " + err.Error())
+	}
+
+	fileRetriever := &LocalFileRetriever{
+		logger:    logger,
+		config:    config,
+		root:      root,
+		statePath: statePath,
+	}
+	if config.DestinationFolderID != "" {
+		destination, err := filepath.Abs(config.DestinationFolderID)
+		if err != nil {
+			logger.Fatal("Unable to resolve destination directory: " + err.Error())
+		}
+		if rel, err := filepath.Rel(root, destination); err != nil || escapes(rel) {
+			fileRetriever.destination = destination
+		}
+	}
+	if err := fileRetriever.loadState(); err != nil {
+		logger.Fatal("Unable to read local state file: " + err.Error())
+	}
+	return fileRetriever
+}
+
+//GetFileInfo walks the parent directory and returns every unprocessed file
+//with a configured extension
+func (l *LocalFileRetriever) GetFileInfo(ctx context.Context) ([]*fileretrieveriface.RenameInfo, error) {
+	var files []*fileretrieveriface.RenameInfo
+	err := l.walk(ctx, func(path, rel string, info os.FileInfo) {
+		if !l.hasConfiguredExtension(info.Name()) || l.isProcessed(rel) {
+			return
+		}
+		file := l.existingFile(path, info)
+		file.CreatedDate = info.ModTime().Format(time.RFC3339)
+		file.ParentName = filepath.Base(filepath.Dir(path))
+		file.MimeType = mime.TypeByExtension(filepath.Ext(path))
+		file.Dates = l.mediaDates(path, info)
+		files = append(files, file)
+	})
+	if err != nil {
+		return nil, err
+	}
+	l.saveHashes()
+	if len(files) == 0 {
+		l.logger.Info("Couldn't find any files")
+	} else {
+		l.logger.Info(fmt.Sprintf("Found %d files", len(files)))
+	}
+	return files, nil
+}
+
+//GetProcessedFiles returns the names of processed files that still exist on disk.
+//Entries for files that were moved or deleted are dropped from the state file
+func (l *LocalFileRetriever) GetProcessedFiles(ctx context.Context) map[string]bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	processedFiles := make(map[string]bool)
+	pruned := false
+	for rel := range l.processed {
+		if _, err := os.Stat(filepath.Join(l.root, rel)); err != nil {
+			delete(l.processed, rel)
+			pruned = true
+			continue
+		}
+		processedFiles[filepath.Base(rel)] = true
+	}
+	if pruned {
+		if err := l.saveState(); err != nil {
+			l.logger.Error("Unable to write local state file: " + err.Error())
+		}
+	}
+	l.logger.Info(fmt.Sprintf("Found %d processed files", len(processedFiles)))
+	return processedFiles
+}
+
+//GetExistingFiles returns every file with a configured extension under the parent directory
+func (l *LocalFileRetriever) GetExistingFiles(ctx context.Context) ([]*fileretrieveriface.RenameInfo, error) {
+	var files []*fileretrieveriface.RenameInfo
+	seen := make(map[string]bool)
+	err := l.walk(ctx, func(path, rel string, info os.FileInfo) {
+		if l.hasConfiguredExtension(info.Name()) {
+			files = append(files, l.existingFile(path, info))
+			seen[path] = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//every file is walked, so hashes of files that have gone can be dropped
+	l.mu.Lock()
+	for id := range l.hashes {
+		if !seen[id] {
+			delete(l.hashes, id)
+			l.hashed = true
+		}
+	}
+	l.mu.Unlock()
+	l.saveHashes()
+	return files, nil
+}
+
+//existingFile returns the identity of the file at path. The content is only hashed
+//when duplicates are looked for, since that means reading the whole file
+func (l *LocalFileRetriever) existingFile(path string, info os.FileInfo) *fileretrieveriface.RenameInfo {
+	file := &fileretrieveriface.RenameInfo{
+		ID:       path,
+		Name:     info.Name(),
+		ParentID: filepath.Dir(path),
+		Size:     info.Size(),
+	}
+	if l.config.DuplicatePolicy != "" {
+		file.MD5Checksum = l.hash(path, info)
+	}
+	return file
+}
+
+//hash returns the md5 of the file at path, reading the file only when it isn't
+//cached or has changed since it was hashed
+func (l *LocalFileRetriever) hash(path string, info os.FileInfo) string {
+	modTime := info.ModTime().Format(time.RFC3339Nano)
+	l.mu.Lock()
+	cached, ok := l.hashes[path]
+	l.mu.Unlock()
+	if ok && cached.Size == info.Size() && cached.ModTime == modTime {
+		return cached.MD5
+	}
+
+	sum, err := fileMD5(path)
+	if err != nil {
+		l.logger.Warn(fmt.Sprintf("Unable to hash %s - %s", path, err.Error()))
+		return ""
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hashes[path] = &fileHash{Size: info.Size(), ModTime: modTime, MD5: sum}
+	l.hashed = true
+	return sum
+}
+
+//saveHashes writes the state file if any file was hashed since it was last written
+func (l *LocalFileRetriever) saveHashes() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.hashed {
+		return
+	}
+	if err := l.saveState(); err != nil {
+		l.logger.Error("Unable to write local state file: " + err.Error())
+	}
+}
+
+//fileMD5 returns the hex md5 of the content of the file at path
+func fileMD5(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := md5.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+//UpdateFile renames the file within its directory and records it as processed.
+//Since IDs are paths, info.ID is changed to the new path
+func (l *LocalFileRetriever) UpdateFile(ctx context.Context, info *fileretrieveriface.RenameInfo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	rel, err := l.rename(info)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.processed[rel] = true
+	return l.saveState()
+}
+
+//RevertFile renames the file back to info.Name and forgets that it was processed
+func (l *LocalFileRetriever) RevertFile(ctx context.Context, info *fileretrieveriface.RenameInfo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	oldRel, err := filepath.Rel(l.root, info.ID)
+	if err != nil {
+		return err
+	}
+	if _, err = l.rename(info); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.processed, oldRel)
+	return l.saveState()
+}
+
+//MoveFile moves the file into the directory at folderID, creating it if needed.
+//Since IDs are paths, info.ID is changed to the new path
+func (l *LocalFileRetriever) MoveFile(ctx context.Context, info *fileretrieveriface.RenameInfo, folderID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	folderID, err := filepath.Abs(folderID)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(folderID, 0755); err != nil {
+		return err
+	}
+	newPath := filepath.Join(folderID, filepath.Base(info.ID))
+	if _, err := os.Stat(newPath); err == nil {
+		return fmt.Errorf("%s already exists", newPath)
+	}
+	if err := os.Rename(info.ID, newPath); err != nil {
+		return err
+	}
+	l.moveHash(info.ID, newPath)
+
+	oldRel, err := filepath.Rel(l.root, info.ID)
+	info.ID = newPath
+	if err != nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.processed[oldRel] {
+		return nil
+	}
+	delete(l.processed, oldRel)
+	return l.saveState()
+}
+
+//TrashFile isn't supported, there's no trash to restore files from on every platform
+func (l *LocalFileRetriever) TrashFile(ctx context.Context, info *fileretrieveriface.RenameInfo) error {
+	return errors.New("the local backend has no trash, quarantine duplicates instead")
+}
+
+//FindOrCreateFolder returns the path of the directory called name in the directory at
+//parentID, creating it if it doesn't exist
+func (l *LocalFileRetriever) FindOrCreateFolder(ctx context.Context, parentID string, name string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	//folder paths are made absolute, since a relative parentDirID would give relative IDs
+	//that can't be compared with the paths found walking root
+	path, err := filepath.Abs(filepath.Join(parentID, name))
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(path, 0755); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+//rename moves the file at info.ID to info.Name in the directory at info.TargetParentID,
+//or the same directory if it's empty. It updates info.ID and returns the new path relative to root
+func (l *LocalFileRetriever) rename(info *fileretrieveriface.RenameInfo) (string, error) {
+	dir := filepath.Dir(info.ID)
+	if info.TargetParentID != "" {
+		dir = info.TargetParentID
+	}
+	if info.Name != filepath.Base(info.Name) || info.Name == ".." {
+		return "", fmt.Errorf("%q is not a file name", info.Name)
+	}
+	newPath, err := filepath.Abs(filepath.Join(dir, info.Name))
+	if err != nil {
+		return "", err
+	}
+	//the relative path is worked out before the file is moved, so a file is never
+	//moved somewhere it can't be recorded as processed
+	rel, err := filepath.Rel(l.root, newPath)
+	if err != nil {
+		return "", err
+	}
+	if newPath != info.ID {
+		if _, err := os.Stat(newPath); err == nil {
+			return "", fmt.Errorf("%s already exists", newPath)
+		}
+		if err := os.Rename(info.ID, newPath); err != nil {
+			return "", err
+		}
+		l.moveHash(info.ID, newPath)
+		info.ID = newPath
+	}
+	return rel, nil
+}
+
+//moveHash keeps the cached hash of a file that was moved, since its content hasn't changed
+func (l *LocalFileRetriever) moveHash(oldPath, newPath string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if cached, ok := l.hashes[oldPath]; ok {
+		delete(l.hashes, oldPath)
+		l.hashes[newPath] = cached
+		l.hashed = true
+	}
+}
+
+//mediaDates returns the dates of the file for each date source. The file is only
+//opened for sources that are in the configured date source chain
+func (l *LocalFileRetriever) mediaDates(path string, info os.FileInfo) map[string]string {
+	modified := info.ModTime().Format(time.RFC3339)
+	dates := map[string]string{
+		fileretrieveriface.DateSourceCreated:  modified,
+		fileretrieveriface.DateSourceModified: modified,
+	}
+	if l.config.UsesDateSource(fileretrieveriface.DateSourceExif) || l.config.UsesDateSource(fileretrieveriface.DateSourceImageMetadata) {
+		//drive's image metadata date is the exif date, so it's read from the file here
+		if taken, err := exifDate(path); err == nil {
+			dates[fileretrieveriface.DateSourceExif] = taken.Format(time.RFC3339)
+			dates[fileretrieveriface.DateSourceImageMetadata] = taken.Format(time.RFC3339)
+		}
+	}
+	if l.config.UsesDateSource(fileretrieveriface.DateSourceVideo) {
+		if taken, err := videoDate(path); err == nil {
+			dates[fileretrieveriface.DateSourceVideo] = taken.Format(time.RFC3339)
+		}
+	}
+	return dates
+}
+
+//walk calls fn for every regular file under root, and under the destination when it's
+//somewhere else, skipping the state file. rel is always relative to root. The walk
+//stops with the context's error once ctx is done
+func (l *LocalFileRetriever) walk(ctx context.Context, fn func(path, rel string, info os.FileInfo)) error {
+	roots := []string{l.root}
+	if l.destination != "" {
+		roots = append(roots, l.destination)
+	}
+	for _, root := range roots {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() || path == l.statePath {
+				return nil
+			}
+			rel, err := filepath.Rel(l.root, path)
+			if err != nil {
+				return err
+			}
+			fn(path, rel, info)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//escapes returns true when the relative path rel leads out of the directory it's relative to.
+//A name that only starts with dots, such as "..archive", stays inside
+func escapes(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (l *LocalFileRetriever) hasConfiguredExtension(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range l.config.FileExtensions {
+		if strings.HasSuffix(name, "."+strings.ToLower(strings.TrimPrefix(ext, "."))) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *LocalFileRetriever) isProcessed(rel string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.processed[rel]
+}
+
+func (l *LocalFileRetriever) loadState() error {
+	l.processed = make(map[string]bool)
+	l.hashes = make(map[string]*fileHash)
+	b, err := ioutil.ReadFile(l.statePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	state := localState{}
+	if err = json.Unmarshal(b, &state); err != nil {
+		return err
+	}
+	for _, rel := range state.Processed {
+		l.processed[rel] = true
+	}
+	if state.Hashes != nil {
+		l.hashes = state.Hashes
+	}
+	return nil
+}
+
+//saveState writes the state file through a temp file so a crash can't truncate it.
+//Callers must hold l.mu
+func (l *LocalFileRetriever) saveState() error {
+	state := localState{Hashes: l.hashes}
+	for rel := range l.processed {
+		state.Processed = append(state.Processed, rel)
+	}
+	sort.Strings(state.Processed)
+	b, err := json.MarshalIndent(state, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := l.statePath + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, l.statePath); err != nil {
+		return err
+	}
+	l.hashed = false
+	return nil
+}
@@ -0,0 +1,226 @@
+package fileretriever
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/davidparks11/file-renamer/pkg/config"
+	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
+	"github.com/davidparks11/file-renamer/pkg/logger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LocalFileRetriever", func() {
+	var (
+		dir string
+		cfg *config.Config
+		ctx = context.Background()
+	)
+
+	//write creates a file under dir with the given content
+	write := func(rel string, content string) string {
+		path := filepath.Join(dir, rel)
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(content), 0644)).To(Succeed())
+		return path
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "localservice")
+		Expect(err).To(BeNil())
+		dir, err = filepath.EvalSymlinks(dir)
+		Expect(err).To(BeNil())
+		cfg = &config.Config{
+			ParentDirID:    filepath.Join(dir, "p"),
+			FileExtensions: []string{"jpg"},
+		}
+		Expect(os.MkdirAll(cfg.ParentDirID, 0755)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	//names returns the names of files
+	names := func(files []*fileretrieveriface.RenameInfo) []string {
+		var found []string
+		for _, file := range files {
+			found = append(found, file.Name)
+		}
+		return found
+	}
+
+	It("should list unprocessed files with a configured extension", func() {
+		write("p/a.jpg", "a")
+		write("p/B.JPG", "b")
+		write("p/day/c.jpg", "c")
+		write("p/d.mov", "d")
+		retriever := NewLocalFileRetriever(&logger.MockLogger{}, cfg)
+
+		files, err := retriever.GetFileInfo(ctx)
+		Expect(err).To(BeNil())
+		Expect(names(files)).To(ConsistOf("a.jpg", "B.JPG", "c.jpg"))
+		for _, file := range files {
+			Expect(file.ID).To(Equal(filepath.Join(file.ParentID, file.Name)))
+			if file.Name == "c.jpg" {
+				Expect(file.ParentName).To(Equal("day"))
+			}
+		}
+	})
+
+	It("should leave out a state file given by a relative path", func() {
+		write("p/a.jpg", "a")
+		wd, err := os.Getwd()
+		Expect(err).To(BeNil())
+		Expect(os.Chdir(dir)).To(Succeed())
+		defer os.Chdir(wd)
+		cfg.LocalStatePath = filepath.Join("p", "state.jpg")
+		retriever := NewLocalFileRetriever(&logger.MockLogger{}, cfg)
+		Expect(retriever.UpdateFile(ctx, &fileretrieveriface.RenameInfo{ID: filepath.Join(dir, "p", "a.jpg"), Name: "b.jpg"})).To(Succeed())
+		Expect(filepath.Join(dir, "p", "state.jpg")).To(BeAnExistingFile())
+
+		files, err := NewLocalFileRetriever(&logger.MockLogger{}, cfg).GetFileInfo(ctx)
+		Expect(err).To(BeNil())
+		Expect(files).To(BeEmpty())
+	})
+
+	It("should rename a file in place and remember it in the state file", func() {
+		path := write("p/a.jpg", "a")
+		retriever := NewLocalFileRetriever(&logger.MockLogger{}, cfg)
+		file := &fileretrieveriface.RenameInfo{ID: path, Name: "b.jpg"}
+		Expect(retriever.UpdateFile(ctx, file)).To(Succeed())
+
+		Expect(file.ID).To(Equal(filepath.Join(cfg.ParentDirID, "b.jpg")))
+		Expect(path).NotTo(BeAnExistingFile())
+		state, err := ioutil.ReadFile(filepath.Join(cfg.ParentDirID, defaultLocalStateFile))
+		Expect(err).To(BeNil())
+		Expect(string(state)).To(ContainSubstring(`"b.jpg"`))
+
+		//a new retriever reads which files are processed from the state file
+		files, err := NewLocalFileRetriever(&logger.MockLogger{}, cfg).GetFileInfo(ctx)
+		Expect(err).To(BeNil())
+		Expect(files).To(BeEmpty())
+	})
+
+	It("should put a file back and forget it was processed when reverted", func() {
+		path := write("p/a.jpg", "a")
+		retriever := NewLocalFileRetriever(&logger.MockLogger{}, cfg)
+		file := &fileretrieveriface.RenameInfo{ID: path, Name: "b.jpg"}
+		Expect(retriever.UpdateFile(ctx, file)).To(Succeed())
+
+		Expect(retriever.RevertFile(ctx, &fileretrieveriface.RenameInfo{ID: file.ID, Name: "a.jpg"})).To(Succeed())
+		Expect(path).To(BeAnExistingFile())
+		Expect(retriever.GetProcessedFiles(ctx)).To(BeEmpty())
+		files, err := retriever.GetFileInfo(ctx)
+		Expect(err).To(BeNil())
+		Expect(names(files)).To(ConsistOf("a.jpg"))
+	})
+
+	It("should drop processed files that have gone from the state file", func() {
+		path := write("p/a.jpg", "a")
+		retriever := NewLocalFileRetriever(&logger.MockLogger{}, cfg)
+		file := &fileretrieveriface.RenameInfo{ID: path, Name: "b.jpg"}
+		Expect(retriever.UpdateFile(ctx, file)).To(Succeed())
+		Expect(retriever.GetProcessedFiles(ctx)).To(HaveKey("b.jpg"))
+
+		Expect(os.Remove(file.ID)).To(Succeed())
+		Expect(retriever.GetProcessedFiles(ctx)).To(BeEmpty())
+		state, err := ioutil.ReadFile(filepath.Join(cfg.ParentDirID, defaultLocalStateFile))
+		Expect(err).To(BeNil())
+		Expect(string(state)).NotTo(ContainSubstring(`"b.jpg"`))
+	})
+
+	It("should not rename a file out of its directory", func() {
+		path := write("p/a.jpg", "a")
+		retriever := NewLocalFileRetriever(&logger.MockLogger{}, cfg)
+		for _, name := range []string{"../b.jpg", "day/b.jpg", ".."} {
+			err := retriever.UpdateFile(ctx, &fileretrieveriface.RenameInfo{ID: path, Name: name})
+			Expect(err).To(MatchError(ContainSubstring("is not a file name")))
+		}
+		Expect(path).To(BeAnExistingFile())
+	})
+
+	It("should search a destination outside the parent directory, and only once inside it", func() {
+		write("p/a.jpg", "a")
+		write("p/..archive/b.jpg", "b")
+		write("outside/c.jpg", "c")
+
+		cfg.DestinationFolderID = filepath.Join(cfg.ParentDirID, "..archive")
+		files, err := NewLocalFileRetriever(&logger.MockLogger{}, cfg).GetFileInfo(ctx)
+		Expect(err).To(BeNil())
+		Expect(names(files)).To(ConsistOf("a.jpg", "b.jpg"))
+
+		cfg.DestinationFolderID = filepath.Join(dir, "outside")
+		files, err = NewLocalFileRetriever(&logger.MockLogger{}, cfg).GetFileInfo(ctx)
+		Expect(err).To(BeNil())
+		Expect(names(files)).To(ConsistOf("a.jpg", "b.jpg", "c.jpg"))
+	})
+
+	Describe("with a relative parent directory", func() {
+		var wd string
+
+		BeforeEach(func() {
+			var err error
+			wd, err = os.Getwd()
+			Expect(err).To(BeNil())
+			Expect(os.Chdir(dir)).To(Succeed())
+			cfg.ParentDirID = "p"
+		})
+
+		AfterEach(func() {
+			Expect(os.Chdir(wd)).To(Succeed())
+		})
+
+		It("should move a file into a date folder and record it as processed", func() {
+			write("p/a.jpg", "a")
+			retriever := NewLocalFileRetriever(&logger.MockLogger{}, cfg)
+			files, err := retriever.GetFileInfo(ctx)
+			Expect(err).To(BeNil())
+			Expect(files).To(HaveLen(1))
+
+			year, err := retriever.FindOrCreateFolder(ctx, cfg.ParentDirID, "2026")
+			Expect(err).To(BeNil())
+			Expect(filepath.IsAbs(year)).To(BeTrue())
+			file := files[0]
+			file.Name = "b.jpg"
+			file.TargetParentID = year
+			Expect(retriever.UpdateFile(ctx, file)).To(Succeed())
+
+			Expect(file.ID).To(Equal(filepath.Join(dir, "p", "2026", "b.jpg")))
+			Expect(file.ID).To(BeAnExistingFile())
+			Expect(retriever.GetProcessedFiles(ctx)).To(HaveKey("b.jpg"))
+			files, err = retriever.GetFileInfo(ctx)
+			Expect(err).To(BeNil())
+			Expect(files).To(BeEmpty())
+		})
+	})
+
+	It("should only hash files again once they change", func() {
+		cfg.DuplicatePolicy = "rename"
+		path := write("p/a.jpg", "a")
+		stamp := time.Date(2020, 8, 31, 19, 0, 0, 0, time.UTC)
+		Expect(os.Chtimes(path, stamp, stamp)).To(Succeed())
+		files, err := NewLocalFileRetriever(&logger.MockLogger{}, cfg).GetFileInfo(ctx)
+		Expect(err).To(BeNil())
+		first := files[0].MD5Checksum
+		Expect(first).NotTo(BeEmpty())
+
+		//same size and time, so a later run takes the hash kept in the state file
+		write("p/a.jpg", "b")
+		Expect(os.Chtimes(path, stamp, stamp)).To(Succeed())
+		retriever := NewLocalFileRetriever(&logger.MockLogger{}, cfg)
+		existing, err := retriever.GetExistingFiles(ctx)
+		Expect(err).To(BeNil())
+		Expect(existing[0].MD5Checksum).To(Equal(first))
+
+		Expect(os.Chtimes(path, stamp, stamp.Add(time.Second))).To(Succeed())
+		existing, err = retriever.GetExistingFiles(ctx)
+		Expect(err).To(BeNil())
+		Expect(existing[0].MD5Checksum).NotTo(Equal(first))
+	})
+})
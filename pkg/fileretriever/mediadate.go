@@ -0,0 +1,119 @@
+package fileretriever
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+const (
+	//exifDateLayout is how drive's imageMediaMetadata.date and exif dates are written
+	exifDateLayout = "2006:01:02 15:04:05"
+	//quickTimeEpochOffset is the number of seconds between 1904-01-01, the epoch used
+	//by mp4 and mov files, and the unix epoch
+	quickTimeEpochOffset = 2082844800
+)
+
+var errNoMediaDate = errors.New("no capture date found")
+
+//exifDate returns the DateTimeOriginal of an image with exif metadata. Exif dates
+//have no time zone, so the wall clock time is returned as UTC to keep the same day
+func exifDate(path string) (time.Time, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+
+	x, err := exif.Decode(file)
+	if err != nil {
+		return time.Time{}, err
+	}
+	tag, err := x.Get(exif.DateTimeOriginal)
+	if err != nil {
+		return time.Time{}, err
+	}
+	value, err := tag.StringVal()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(exifDateLayout, value)
+}
+
+//videoDate returns the creation time from the movie header (mvhd) of an mp4 or mov file
+func videoDate(path string) (time.Time, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	//the mvhd box lives inside the top level moov box
+	moovStart, moovSize, err := findBox(file, 0, info.Size(), "moov")
+	if err != nil {
+		return time.Time{}, err
+	}
+	mvhdStart, _, err := findBox(file, moovStart, moovStart+moovSize, "mvhd")
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	//version (1 byte) and flags (3 bytes), then the creation time which is
+	//32 bits for version 0 and 64 bits for version 1
+	header := make([]byte, 12)
+	if _, err = file.ReadAt(header, mvhdStart); err != nil {
+		return time.Time{}, err
+	}
+	var seconds uint64
+	if header[0] == 1 {
+		seconds = binary.BigEndian.Uint64(header[4:12])
+	} else {
+		seconds = uint64(binary.BigEndian.Uint32(header[4:8]))
+	}
+	if seconds == 0 {
+		return time.Time{}, errNoMediaDate
+	}
+	return time.Unix(int64(seconds)-quickTimeEpochOffset, 0).UTC(), nil
+}
+
+//findBox walks the boxes between start and end looking for boxType. It returns the
+//offset of the box's contents and the size of its contents
+func findBox(r io.ReaderAt, start int64, end int64, boxType string) (int64, int64, error) {
+	header := make([]byte, 16)
+	for offset := start; offset+8 <= end; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return 0, 0, err
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			//box runs to the end of the file
+			size = end - offset
+		case 1:
+			//64 bit size follows the type
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return 0, 0, err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if size < headerSize {
+			return 0, 0, errNoMediaDate
+		}
+		if string(header[4:8]) == boxType {
+			return offset + headerSize, size - headerSize, nil
+		}
+		offset += size
+	}
+	return 0, 0, errNoMediaDate
+}
@@ -0,0 +1,157 @@
+package fileretriever
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/api/drive/v2"
+)
+
+//jpegWithExif returns a jpeg holding only an exif block with a DateTimeOriginal of taken
+func jpegWithExif(taken string) []byte {
+	le := binary.LittleEndian
+	var tiff bytes.Buffer
+	//header, then IFD0 at offset 8 with a single pointer to the exif IFD
+	tiff.WriteString("II")
+	binary.Write(&tiff, le, uint16(42))
+	binary.Write(&tiff, le, uint32(8))
+	binary.Write(&tiff, le, uint16(1))
+	binary.Write(&tiff, le, []uint16{0x8769, 4})
+	binary.Write(&tiff, le, []uint32{1, 26})
+	binary.Write(&tiff, le, uint32(0))
+	//exif IFD at offset 26 with DateTimeOriginal, its value follows the IFD at offset 44
+	binary.Write(&tiff, le, uint16(1))
+	binary.Write(&tiff, le, []uint16{0x9003, 2})
+	binary.Write(&tiff, le, []uint32{uint32(len(taken) + 1), 44})
+	binary.Write(&tiff, le, uint32(0))
+	tiff.WriteString(taken + "\x00")
+
+	var jpeg bytes.Buffer
+	jpeg.Write([]byte{0xFF, 0xD8, 0xFF, 0xE1})
+	binary.Write(&jpeg, binary.BigEndian, uint16(2+6+tiff.Len()))
+	jpeg.WriteString("Exif\x00\x00")
+	jpeg.Write(tiff.Bytes())
+	jpeg.Write([]byte{0xFF, 0xD9})
+	return jpeg.Bytes()
+}
+
+//box returns an mp4 box of boxType holding contents
+func box(boxType string, contents ...[]byte) []byte {
+	body := bytes.Join(contents, nil)
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint32(8+len(body)))
+	b.WriteString(boxType)
+	b.Write(body)
+	return b.Bytes()
+}
+
+//mvhd returns a movie header box of version 0 or 1 created at seconds since 1904
+func mvhd(version byte, seconds uint64) []byte {
+	header := []byte{version, 0, 0, 0}
+	created := make([]byte, 8)
+	if version == 1 {
+		binary.BigEndian.PutUint64(created, seconds)
+	} else {
+		binary.BigEndian.PutUint32(created, uint32(seconds))
+		created = created[:4]
+	}
+	//the rest of the header isn't read
+	return box("mvhd", header, created, make([]byte, 80))
+}
+
+var _ = Describe("Media dates", func() {
+	var dir string
+	taken := time.Date(2020, 8, 31, 19, 33, 44, 0, time.UTC)
+	quickTime := uint64(taken.Unix() + quickTimeEpochOffset)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "mediadate")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	write := func(name string, contents []byte) string {
+		path := filepath.Join(dir, name)
+		Expect(ioutil.WriteFile(path, contents, 0644)).To(Succeed())
+		return path
+	}
+
+	Describe("exifDate()", func() {
+		It("should read DateTimeOriginal as a wall clock time in UTC", func() {
+			date, err := exifDate(write("a.jpg", jpegWithExif("2020:08:31 19:33:44")))
+			Expect(err).To(BeNil())
+			Expect(date).To(Equal(taken))
+		})
+
+		It("should fail on images without exif or with a cut off block", func() {
+			_, err := exifDate(write("plain.jpg", []byte{0xFF, 0xD8, 0xFF, 0xD9}))
+			Expect(err).NotTo(BeNil())
+
+			full := jpegWithExif("2020:08:31 19:33:44")
+			_, err = exifDate(write("cut.jpg", full[:30]))
+			Expect(err).NotTo(BeNil())
+		})
+	})
+
+	Describe("videoDate()", func() {
+		It("should read the creation time of version 0 and 1 movie headers", func() {
+			for version, path := range map[byte]string{
+				0: write("v0.mp4", append(box("ftyp", []byte("isom")), box("moov", mvhd(0, quickTime))...)),
+				1: write("v1.mov", append(box("ftyp", []byte("qt  ")), box("moov", box("udta"), mvhd(1, quickTime))...)),
+			} {
+				date, err := videoDate(path)
+				Expect(err).To(BeNil(), "version %d", version)
+				Expect(date).To(Equal(taken), "version %d", version)
+			}
+		})
+
+		It("should follow boxes with 64 bit sizes", func() {
+			large := box("mdat", make([]byte, 8), []byte("data"))
+			binary.BigEndian.PutUint32(large, 1)
+			binary.BigEndian.PutUint64(large[8:], uint64(len(large)))
+			date, err := videoDate(write("large.mp4", append(large, box("moov", mvhd(0, quickTime))...)))
+			Expect(err).To(BeNil())
+			Expect(date).To(Equal(taken))
+		})
+
+		It("should fail on truncated or corrupt files", func() {
+			movie := append(box("ftyp", []byte("isom")), box("moov", mvhd(0, quickTime))...)
+			corrupt := append([]byte{}, movie...)
+			//a box smaller than its own header
+			binary.BigEndian.PutUint32(corrupt, 4)
+
+			for name, contents := range map[string][]byte{
+				"empty.mp4":     {},
+				"truncated.mp4": movie[:len(movie)-90],
+				"corrupt.mp4":   corrupt,
+				"nomoov.mp4":    box("ftyp", []byte("isom")),
+				"undated.mp4":   box("moov", mvhd(0, 0)),
+			} {
+				_, err := videoDate(write(name, contents))
+				Expect(err).NotTo(BeNil(), name)
+			}
+		})
+	})
+
+	Describe("renameInfo()", func() {
+		It("should take drive's image metadata date for exif", func() {
+			info := (&FileRetriever{}).renameInfo(&drive.File{
+				Id:                 "a",
+				ImageMediaMetadata: &drive.FileImageMediaMetadata{Date: "2020:08:31 19:33:44"},
+			})
+			Expect(info.Dates).To(HaveKeyWithValue(fileretrieveriface.DateSourceExif, "2020-08-31T19:33:44Z"))
+			Expect(info.Dates).To(HaveKeyWithValue(fileretrieveriface.DateSourceImageMetadata, "2020-08-31T19:33:44Z"))
+		})
+	})
+})
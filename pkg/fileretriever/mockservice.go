@@ -1,7 +1,7 @@
 package fileretriever
 
 import (
-	"fmt"
+	"context"
 
 	"github.com/davidparks11/file-renamer/pkg/fileretriever/fileretrieveriface"
 	"github.com/stretchr/testify/mock"
@@ -15,7 +15,7 @@ type MockFileRetriever struct {
 }
 
 //GetFileInfo mocks a call to gdrive
-func (m *MockFileRetriever)GetFileInfo() ([]*fileretrieveriface.RenameInfo, error) {
+func (m *MockFileRetriever)GetFileInfo(ctx context.Context) ([]*fileretrieveriface.RenameInfo, error) {
 	// mockFileInfo := []*fileretrieveriface.RenameInfo{
 	// 	{
 	// 		ID:          "11111111",
@@ -42,21 +42,44 @@ func (m *MockFileRetriever)GetFileInfo() ([]*fileretrieveriface.RenameInfo, erro
 	return args.Get(0).([]*fileretrieveriface.RenameInfo), nil
 }
 
-//CheckForDuplicate mocks a call to gdrive to check if a file exists
-func (m *MockFileRetriever) IsUniqueName(name string) bool {
-args := m.Called(name)
-return args.Bool(0)
+//GetExistingFiles mocks a call to gdrive to list every file in the parent folder
+func (m *MockFileRetriever) GetExistingFiles(ctx context.Context) ([]*fileretrieveriface.RenameInfo, error) {
+	args := m.Called()
+	return args.Get(0).([]*fileretrieveriface.RenameInfo), args.Error(1)
 }
 
 //UpdateFile it just returns nil
-func (m *MockFileRetriever) UpdateFile(info *fileretrieveriface.RenameInfo) error {
-	fmt.Println("\n\n\n\n\n~~~~~~~~~~~~~~~"+info.Name+"~~~~~~~~~~~~~\n\n\n\n\n")
+func (m *MockFileRetriever) UpdateFile(ctx context.Context, info *fileretrieveriface.RenameInfo) error {
 	args := m.Called(info)
 	return args.Error(0)
 }
 
-func (m *MockFileRetriever) GetProcessedFiles() map[string]bool {
+func (m *MockFileRetriever) GetProcessedFiles(ctx context.Context) map[string]bool {
 	//files := map[string]bool {"foo_2020_0901.mov": true}
 	args := m.Called()
 	return args.Get(0).(map[string]bool)
 }
+
+//RevertFile mocks a call to gdrive to restore a file name
+func (m *MockFileRetriever) RevertFile(ctx context.Context, info *fileretrieveriface.RenameInfo) error {
+	args := m.Called(info)
+	return args.Error(0)
+}
+
+//MoveFile mocks a call to gdrive to move a file to another folder
+func (m *MockFileRetriever) MoveFile(ctx context.Context, info *fileretrieveriface.RenameInfo, folderID string) error {
+	args := m.Called(info, folderID)
+	return args.Error(0)
+}
+
+//TrashFile mocks a call to gdrive to trash a file
+func (m *MockFileRetriever) TrashFile(ctx context.Context, info *fileretrieveriface.RenameInfo) error {
+	args := m.Called(info)
+	return args.Error(0)
+}
+
+//FindOrCreateFolder mocks a call to gdrive to find or create a folder
+func (m *MockFileRetriever) FindOrCreateFolder(ctx context.Context, parentID string, name string) (string, error) {
+	args := m.Called(parentID, name)
+	return args.String(0), args.Error(1)
+}
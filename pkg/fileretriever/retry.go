@@ -0,0 +1,170 @@
+package fileretriever
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/davidparks11/file-renamer/pkg/config"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	defaultRetryMaxAttempts   = 5
+	defaultRetryBaseDelay     = time.Second
+	defaultRetryMaxDelay      = 32 * time.Second
+	defaultRetryMaxTotalDelay = 2 * time.Minute
+)
+
+//allows control of sleeping for testing
+var sleep = sleepContext
+
+//sleepContext waits for d, or returns the context's error if it's done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+//retryPolicy decides how often and how long to wait before retrying a failed drive call
+type retryPolicy struct {
+	maxAttempts   int
+	baseDelay     time.Duration
+	maxDelay      time.Duration
+	maxTotalDelay time.Duration
+}
+
+//newRetryPolicy builds a retry policy from config, using defaults for anything unset
+func newRetryPolicy(config *config.Config) (*retryPolicy, error) {
+	policy := &retryPolicy{
+		maxAttempts:   defaultRetryMaxAttempts,
+		baseDelay:     defaultRetryBaseDelay,
+		maxDelay:      defaultRetryMaxDelay,
+		maxTotalDelay: defaultRetryMaxTotalDelay,
+	}
+	if config.RetryMaxAttempts > 0 {
+		policy.maxAttempts = config.RetryMaxAttempts
+	}
+	durations := []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"retryBaseDelay", config.RetryBaseDelay, &policy.baseDelay},
+		{"retryMaxDelay", config.RetryMaxDelay, &policy.maxDelay},
+		{"retryMaxTotalDelay", config.RetryMaxTotalDelay, &policy.maxTotalDelay},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", d.name, err.Error())
+		}
+		*d.dest = parsed
+	}
+	return policy, nil
+}
+
+//retry calls call until it succeeds, fails with an error that isn't transient,
+//the policy runs out of attempts or total delay, or ctx is done
+func (f *FileRetriever) retry(ctx context.Context, operation string, call func() error) error {
+	var totalDelay time.Duration
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := call()
+		if err == nil {
+			if attempt > 1 {
+				f.logger.Info(fmt.Sprintf("%s succeeded after %d retries", operation, attempt-1))
+			}
+			return nil
+		}
+
+		retryable, retryAfter := isRetryable(err)
+		if !retryable {
+			return err
+		}
+		if attempt >= f.retryPolicy.maxAttempts {
+			return fmt.Errorf("%s failed after %d attempts: %s", operation, attempt, err.Error())
+		}
+
+		delay := retryAfter
+		if delay == 0 {
+			delay = f.retryPolicy.backoff(attempt)
+		}
+		if totalDelay+delay > f.retryPolicy.maxTotalDelay {
+			return fmt.Errorf("%s failed after %d attempts and %s of retries: %s", operation, attempt, totalDelay, err.Error())
+		}
+		totalDelay += delay
+
+		f.logger.Warn(fmt.Sprintf("%s failed, retry %d of %d in %s - %s", operation, attempt, f.retryPolicy.maxAttempts-1, delay, err.Error()))
+		if err = sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+//backoff returns a random delay up to baseDelay*2^(attempt-1), capped at maxDelay
+func (p *retryPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.baseDelay << uint(attempt-1)
+	if ceiling > p.maxDelay || ceiling <= 0 {
+		ceiling = p.maxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling))) + 1
+}
+
+//isRetryable returns true for errors drive documents as transient: rate limit 403s,
+//429s and 5xx responses. If drive asked for a delay with Retry-After, it is returned too
+func isRetryable(err error) (bool, time.Duration) {
+	apiErr, ok := err.(*googleapi.Error)
+	if !ok {
+		return false, 0
+	}
+
+	retryable := false
+	switch {
+	case apiErr.Code == http.StatusTooManyRequests, apiErr.Code >= 500:
+		retryable = true
+	case apiErr.Code == http.StatusForbidden:
+		for _, item := range apiErr.Errors {
+			if item.Reason == "rateLimitExceeded" || item.Reason == "userRateLimitExceeded" {
+				retryable = true
+			}
+		}
+	}
+	if !retryable {
+		return false, 0
+	}
+	return true, retryAfter(apiErr.Header)
+}
+
+//retryAfter parses a Retry-After header given either in seconds or as an http date
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
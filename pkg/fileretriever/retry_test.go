@@ -0,0 +1,145 @@
+package fileretriever
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/davidparks11/file-renamer/pkg/logger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/drive/v2"
+	"google.golang.org/api/googleapi"
+)
+
+var _ = Describe("retry()", func() {
+	var slept []time.Duration
+	retriever := &FileRetriever{
+		logger: &logger.MockLogger{},
+		retryPolicy: &retryPolicy{
+			maxAttempts:   3,
+			baseDelay:     time.Second,
+			maxDelay:      4 * time.Second,
+			maxTotalDelay: time.Minute,
+		},
+	}
+	rateLimited := &googleapi.Error{
+		Code:   http.StatusForbidden,
+		Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}},
+	}
+
+	BeforeEach(func() {
+		slept = nil
+		sleep = func(ctx context.Context, d time.Duration) error {
+			slept = append(slept, d)
+			return nil
+		}
+	})
+
+	AfterEach(func() {
+		sleep = sleepContext
+	})
+
+	It("should retry rate limit errors until the call succeeds", func() {
+		calls := 0
+		err := retriever.retry(context.Background(), "test", func() error {
+			calls++
+			if calls < 3 {
+				return rateLimited
+			}
+			return nil
+		})
+		Expect(err).To(BeNil())
+		Expect(calls).To(Equal(3))
+		Expect(slept).To(HaveLen(2))
+		Expect(slept[1]).To(BeNumerically("<=", 2*time.Second))
+	})
+
+	It("should give up after the max attempts", func() {
+		calls := 0
+		err := retriever.retry(context.Background(), "test", func() error {
+			calls++
+			return &googleapi.Error{Code: http.StatusServiceUnavailable}
+		})
+		Expect(err).NotTo(BeNil())
+		Expect(calls).To(Equal(3))
+	})
+
+	It("should honor Retry-After", func() {
+		calls := 0
+		header := http.Header{}
+		header.Set("Retry-After", "7")
+		retriever.retry(context.Background(), "test", func() error {
+			calls++
+			if calls == 1 {
+				return &googleapi.Error{Code: http.StatusTooManyRequests, Header: header}
+			}
+			return nil
+		})
+		Expect(slept).To(Equal([]time.Duration{7 * time.Second}))
+	})
+
+	It("should not retry other errors", func() {
+		calls := 0
+		retriever.retry(context.Background(), "test", func() error {
+			calls++
+			return errors.New("bad request")
+		})
+		Expect(calls).To(Equal(1))
+		Expect(slept).To(BeEmpty())
+	})
+
+	It("should stop retrying once the context is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		calls := 0
+		err := retriever.retry(ctx, "test", func() error {
+			calls++
+			cancel()
+			return rateLimited
+		})
+		Expect(err).To(Equal(context.Canceled))
+		Expect(calls).To(Equal(1))
+	})
+})
+
+var _ = Describe("FindOrCreateFolder()", func() {
+	It("should look for the folder again before retrying a failed insert", func() {
+		sleep = func(ctx context.Context, d time.Duration) error { return nil }
+		defer func() { sleep = sleepContext }()
+
+		//the first insert makes the folder but fails, like a timeout after drive has made it
+		var folders []*drive.File
+		inserts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if r.Method == http.MethodPost {
+				inserts++
+				folders = append(folders, &drive.File{Id: "made", Title: "2020"})
+				w.WriteHeader(http.StatusServiceUnavailable)
+				json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": 503, "message": "backend error"}})
+				return
+			}
+			json.NewEncoder(w).Encode(&drive.FileList{Items: folders})
+		}))
+		defer server.Close()
+		service, err := drive.New(server.Client())
+		Expect(err).To(BeNil())
+		service.BasePath = server.URL + "/"
+		retriever := &FileRetriever{
+			logger:       &logger.MockLogger{},
+			drive:        service,
+			readLimiter:  rate.NewLimiter(rate.Inf, 1),
+			writeLimiter: rate.NewLimiter(rate.Inf, 1),
+			retryPolicy:  &retryPolicy{maxAttempts: 3},
+		}
+
+		id, err := retriever.FindOrCreateFolder(context.Background(), "root", "2020")
+		Expect(err).To(BeNil())
+		Expect(id).To(Equal("made"))
+		Expect(inserts).To(Equal(1))
+	})
+})
@@ -7,6 +7,9 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/davidparks11/file-renamer/pkg/config"
@@ -16,13 +19,18 @@ import (
 	"golang.org/x/oauth2/google"
 	"golang.org/x/time/rate"
 	"google.golang.org/api/drive/v2"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
 const (
 	fileProcessedFlag = "file-renamer-processed"
-	readLimitPerMinute = 300
-	writeLimitPerMinute = 60
+	originalTitleProperty = "file-renamer-original-title"
+	//maxPropertyBytes is drive's limit on the combined size of a property key and value
+	maxPropertyBytes = 124
+	defaultReadLimitPerMinute = 300
+	defaultWriteLimitPerMinute = 60
+	defaultLimiterBurst = 1
 )
 
 var _ fileretrieveriface.FileRetriever = &FileRetriever{}
@@ -33,36 +41,91 @@ type FileRetriever struct {
 	config *config.Config
 	drive  *drive.Service
 	queryableFolders []string
+	//folderNames maps the id of each queryable folder to its title
+	folderNames map[string]string
 	readLimiter *rate.Limiter
 	writeLimiter *rate.Limiter
+	retryPolicy *retryPolicy
+	//changes is the incremental sync state, nil unless incrementalSync is on
+	changes *changesState
+	changesMu sync.Mutex
 }
 
-func (f *FileRetriever) getSubFolders(parentFolder string) ([]string, error) {
-	//slice to hold parent dir and all children dirs under it
-	folderIds := []string{parentFolder}
-	requestCount := 0
+//listFiles calls fn with every file matching query, fetching a page at a time.
+//Each page is retried on its own so a transient error doesn't restart the listing
+func (f *FileRetriever) listFiles(ctx context.Context, operation string, query string, fn func(*drive.File)) error {
+	pageToken := ""
+	for {
+		var fileList *drive.FileList
+		err := f.retry(ctx, operation, func() error {
+			//respect read rate limits
+			if err := f.readLimiter.Wait(ctx); err != nil {
+				return err
+			}
+			call := f.drive.Files.List().MaxResults(1000).Q(query)
+			if pageToken != "" {
+				call = call.PageToken(pageToken)
+			}
+			var err error
+			fileList, err = call.Context(ctx).Do()
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		for _, v := range fileList.Items {
+			fn(v)
+		}
+		if fileList.NextPageToken == "" {
+			return nil
+		}
+		pageToken = fileList.NextPageToken
+	}
+}
+
+//isQuarantine returns true for the folder duplicates are moved to. It's kept out of
+//the tree, so quarantined files aren't found and quarantined again
+func (f *FileRetriever) isQuarantine(id string) bool {
+	return f.config.DuplicatePolicy == config.DuplicateQuarantine && id == f.config.QuarantineFolderID
+}
+
+//getSubFolders returns the ids of the root folders and every folder under them
+func (f *FileRetriever) getSubFolders(ctx context.Context, roots ...string) ([]string, error) {
+	//slice to hold the root dirs and all children dirs under them
+	folderIds := append([]string{}, roots...)
+	f.folderNames = make(map[string]string)
+	for _, root := range roots {
+		var parent *drive.File
+		err := f.retry(ctx, "get parent folder", func() error {
+			if err := f.readLimiter.Wait(ctx); err != nil {
+				return err
+			}
+			var err error
+			parent, err = f.drive.Files.Get(root).Fields("title").Context(ctx).Do()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		f.folderNames[root] = parent.Title
+	}
+
 	folderIndex := 0
 	var query string
 	for len(folderIds) != folderIndex {
 		//Build query for files whose parents are in folderIds
 		query = f.buildChildQuery(folderIds[folderIndex:])
+		//Set folder index to address the first of the next folder ids
 		folderIndex = len(folderIds)
 
-		//Set folder index to address the first of the next folder ids
-		err := f.drive.Children.List(f.config.ParentDirID).
-		MaxResults(1000).
-		Q(query).
-		Pages(
-			context.TODO(),
-			func(folders *drive.ChildList) error {
-				requestCount++
-				for _, v := range folders.Items {
-					folderIds = append(folderIds, v.Id)
-				}
-				return nil
-			},
-		)
-		
+		err := f.listFiles(ctx, "list folders", query, func(v *drive.File) {
+			//the quarantine and everything under it are left out of the tree
+			if f.isQuarantine(v.Id) {
+				return
+			}
+			folderIds = append(folderIds, v.Id)
+			f.folderNames[v.Id] = v.Title
+		})
 		if err != nil {
 			return nil, err
 		}
@@ -71,34 +134,23 @@ func (f *FileRetriever) getSubFolders(parentFolder string) ([]string, error) {
 	return folderIds, nil
 }
 
-func (f *FileRetriever) getFilesFromFolders(folderIds []string) ([]*fileretrieveriface.RenameInfo, error) {
+func (f *FileRetriever) getFilesFromFolders(ctx context.Context, folderIds []string) ([]*fileretrieveriface.RenameInfo, error) {
 	//After all child folder of the config-parent dir have been found
 	//query for any files to rename 
 	query := f.buildFileQuery(folderIds)
-	//only get files that have not been processed
-	query += "and not (" + processedQuery + ")"
+	//only get files that have not been processed or trashed
+	query += "and not (" + processedQuery + ") and trashed = false"
 	var files []*fileretrieveriface.RenameInfo
-	err := f.drive.Files.List().
-		MaxResults(1000).
-		Q(query).
-		Pages(
-			context.TODO(),
-			func(fileList *drive.FileList) error {
-				for _, v := range fileList.Items {
-					
-					files = append(files, &fileretrieveriface.RenameInfo{
-						ID: v.Id,
-						Name: v.Title,
-						CreatedDate: v.CreatedDate,
-					})
-					
-				}
-				return nil
-			},
-		)
+	err := f.listFiles(ctx, "list files", query, func(v *drive.File) {
+		files = append(files, f.renameInfo(v))
+	})
 
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	//a partial listing isn't returned, it would be taken for the whole tree
 	if err != nil {
-		f.logger.Error(err.Error())
+		return nil, err
 	}
 	if len(files) == 0 {
 		f.logger.Info("Couldn't find any files")
@@ -109,26 +161,89 @@ func (f *FileRetriever) getFilesFromFolders(folderIds []string) ([]*fileretrieve
 	return files, nil
 }
 
-//GetFileInfo returns all files that match description from config
-func (f *FileRetriever) GetFileInfo() ([]*fileretrieveriface.RenameInfo, error) {
-	folderIds, err := f.getSubFolders(f.config.ParentDirID)
+//renameInfo converts a drive file to the info needed to rename it
+func (f *FileRetriever) renameInfo(v *drive.File) *fileretrieveriface.RenameInfo {
+	info := &fileretrieveriface.RenameInfo{
+		ID: v.Id,
+		Name: v.Title,
+		CreatedDate: v.CreatedDate,
+		MimeType: v.MimeType,
+		MD5Checksum: v.Md5Checksum,
+		Size: v.FileSize,
+		Dates: map[string]string{
+			fileretrieveriface.DateSourceCreated: v.CreatedDate,
+			fileretrieveriface.DateSourceModified: v.ModifiedDate,
+		},
+	}
+	if v.ImageMediaMetadata != nil && v.ImageMediaMetadata.Date != "" {
+		if taken, err := time.Parse(exifDateLayout, v.ImageMediaMetadata.Date); err == nil {
+			//drive reads the date from the exif of the image, so it stands in for exif too
+			info.Dates[fileretrieveriface.DateSourceImageMetadata] = taken.Format(time.RFC3339)
+			info.Dates[fileretrieveriface.DateSourceExif] = taken.Format(time.RFC3339)
+		}
+	}
+	if len(v.OwnerNames) > 0 {
+		info.Owner = v.OwnerNames[0]
+	}
+	for _, parent := range v.Parents {
+		if name, ok := f.folderNames[parent.Id]; ok {
+			info.ParentName = name
+			info.ParentID = parent.Id
+			break
+		}
+	}
+	return info
+}
+
+//GetFileInfo returns all files that match description from config.
+//With incremental sync only files changed since the last run are returned
+func (f *FileRetriever) GetFileInfo(ctx context.Context) ([]*fileretrieveriface.RenameInfo, error) {
+	var pageToken string
+	if f.config.IncrementalSync {
+		files, ok, err := f.getChangedFileInfo(ctx)
+		if ok {
+			return files, err
+		}
+		if pageToken, err = f.startChanges(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	folderIds, err := f.getSubFolders(ctx, f.roots()...)
 	if err != nil {
 		return nil, err
 	}
 	//retain queryable folders for duplicate search
 	f.queryableFolders = folderIds
-	return f.getFilesFromFolders(folderIds)
+	files, err := f.getFilesFromFolders(ctx, folderIds)
+	if err != nil {
+		return nil, err
+	}
+	if f.config.IncrementalSync {
+		f.finishFullScan(pageToken, files)
+	}
+	return files, nil
+}
+
+//roots returns the folders searched for files, parentDirID and the destination
+//files are moved to when it's somewhere else
+func (f *FileRetriever) roots() []string {
+	roots := []string{f.config.ParentDirID}
+	if f.config.DestinationFolderID != "" && f.config.DestinationFolderID != f.config.ParentDirID {
+		roots = append(roots, f.config.DestinationFolderID)
+	}
+	return roots
 }
 
 func (f *FileRetriever) buildChildQuery(folderIds []string) (query string) {
 	if len(folderIds) == 0 {
 		return ""
 	}
-	query = fmt.Sprintf("'%s' in parents ", folderIds[0]) 
+	query = fmt.Sprintf("('%s' in parents ", folderIds[0]) 
 	for i := 1; i < len(folderIds); i++ {
 		query += fmt.Sprintf("or '%s' in parents ", folderIds[i])
 	}
-	query += "and mimeType = 'application/vnd.google-apps.folder'"
+	query += ") and mimeType = 'application/vnd.google-apps.folder'"
 	return query
 }
 
@@ -163,46 +278,48 @@ const processedQuery = "properties has {key='" + fileProcessedFlag + "' and valu
 
 //GetProcessedFiles returns any files that contain the processed flag property
 // with a value of "true"
-func (f *FileRetriever) GetProcessedFiles() map[string]bool {
+func (f *FileRetriever) GetProcessedFiles(ctx context.Context) map[string]bool {
+	if processedFiles := f.cachedProcessedFiles(); processedFiles != nil {
+		f.logger.Info(fmt.Sprintf("Found %d processed files in changes state", len(processedFiles)))
+		return processedFiles
+	}
+
 	processedFiles := make(map[string]bool)
+	processedByID := make(map[string]string)
 	query :=  f.buildFileQuery(f.queryableFolders)
 	query += "and (" + processedQuery + ") "
-	err := f.drive.Files.List().
-		MaxResults(1000).
-		Q(query).
-		Pages(
-			context.TODO(),
-			func(fileList *drive.FileList) error {
-				for _, v := range fileList.Items {
-					processedFiles[v.Title] = true
-				}
-				return nil
-			},
-		)
+	err := f.listFiles(ctx, "list processed files", query, func(v *drive.File) {
+		processedFiles[v.Title] = true
+		processedByID[v.Id] = v.Title
+	})
 
 	if err != nil {
 		f.logger.Error(err.Error())
+	} else {
+		f.cacheProcessedFiles(processedByID)
 	}
 	f.logger.Info(fmt.Sprintf("Found %d processed files", len(processedFiles)))
 	return processedFiles
 }
 
-//IsUniqueName returns true if no file is found with the same name, otherwise, returns false
-func (f *FileRetriever) IsUniqueName(name string) bool {
-	response, err := f.drive.Files.List().
-		Q("title = '" + name + "'").Do()
-
+//GetExistingFiles returns every file in the queryable folders, whether it was renamed or not.
+//Files in the trash are left out so they're never taken as the original of a duplicate
+func (f *FileRetriever) GetExistingFiles(ctx context.Context) ([]*fileretrieveriface.RenameInfo, error) {
+	var files []*fileretrieveriface.RenameInfo
+	query := f.buildFileQuery(f.queryableFolders)
+	query += "and trashed = false"
+	err := f.listFiles(ctx, "list existing files", query, func(v *drive.File) {
+		files = append(files, f.renameInfo(v))
+	})
 	if err != nil {
-		f.logger.Error(err.Error())
-	}
-	if len(response.Items) > 0 {
-		return false
+		return nil, err
 	}
-	return true
+	return files, nil
 }
 
-//UpdateFile gives the file a new name and sets a custom property to true on the file
-func (f *FileRetriever) UpdateFile(info *fileretrieveriface.RenameInfo) error {
+//UpdateFile gives the file a new name and sets a custom property to true on the file.
+//The original title is kept in a property as well so the rename can be undone
+func (f *FileRetriever) UpdateFile(ctx context.Context, info *fileretrieveriface.RenameInfo) error {
 	processedProp := &drive.Property{
 		Key: fileProcessedFlag,
 		Value: "true",
@@ -214,11 +331,159 @@ func (f *FileRetriever) UpdateFile(info *fileretrieveriface.RenameInfo) error {
 		Properties: []*drive.Property{processedProp},
 	}
 
-	//respect write rate limits
-	f.writeLimiter.Wait(context.Background())
+	if info.OriginalName != "" {
+		if len(originalTitleProperty)+len(info.OriginalName) > maxPropertyBytes {
+			f.logger.Warn(fmt.Sprintf("Original title of %s is too long to store on the file", info.ID))
+		} else {
+			file.Properties = append(file.Properties, &drive.Property{
+				Key: originalTitleProperty,
+				Value: info.OriginalName,
+				Visibility: "PUBLIC",
+			})
+		}
+	}
 
-	_, err := f.drive.Files.Update(info.ID, file).Do()
-	return err
+	err := f.retry(ctx, "update file "+info.ID, func() error {
+		//respect write rate limits
+		if err := f.writeLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		_, err := moveTo(f.drive.Files.Update(info.ID, file), info).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	f.markUpdated(info)
+	return nil
+}
+
+//moveTo makes an update move the file to info.TargetParentID, if it's set
+func moveTo(call *drive.FilesUpdateCall, info *fileretrieveriface.RenameInfo) *drive.FilesUpdateCall {
+	if info.TargetParentID == "" || info.TargetParentID == info.ParentID {
+		return call
+	}
+	call = call.AddParents(info.TargetParentID)
+	if info.ParentID != "" {
+		call = call.RemoveParents(info.ParentID)
+	}
+	return call
+}
+
+//RevertFile restores the file's title to info.Name and removes the properties
+//set by UpdateFile so the file is picked up again by the next run
+func (f *FileRetriever) RevertFile(ctx context.Context, info *fileretrieveriface.RenameInfo) error {
+	err := f.retry(ctx, "revert file "+info.ID, func() error {
+		if err := f.writeLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		_, err := moveTo(f.drive.Files.Update(info.ID, &drive.File{Title: info.Name}), info).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range []string{fileProcessedFlag, originalTitleProperty} {
+		err = f.retry(ctx, "delete property "+key, func() error {
+			if err := f.writeLimiter.Wait(ctx); err != nil {
+				return err
+			}
+			return f.drive.Properties.Delete(info.ID, key).Visibility("PUBLIC").Context(ctx).Do()
+		})
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+//FindOrCreateFolder returns the id of the folder called name in the folder with parentID,
+//creating the folder if there isn't one. An insert that failed may still have made the
+//folder, so every attempt looks for it again before inserting
+func (f *FileRetriever) FindOrCreateFolder(ctx context.Context, parentID string, name string) (string, error) {
+	query := fmt.Sprintf("title = '%s' and '%s' in parents and mimeType = '%s' and trashed = false", escapeQuery(name), parentID, folderMimeType)
+	folder := &drive.File{
+		Title: name,
+		MimeType: folderMimeType,
+		Parents: []*drive.ParentReference{{Id: parentID}},
+	}
+	var id string
+	err := f.retry(ctx, "find or create folder "+name, func() error {
+		if err := f.readLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		found, err := f.drive.Files.List().MaxResults(1).Q(query).Context(ctx).Do()
+		if err != nil {
+			return err
+		}
+		if len(found.Items) > 0 {
+			id = found.Items[0].Id
+			return nil
+		}
+
+		if err := f.writeLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		created, err := f.drive.Files.Insert(folder).Context(ctx).Do()
+		if err != nil {
+			return err
+		}
+		id = created.Id
+		if f.folderNames != nil {
+			f.folderNames[created.Id] = name
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+//escapeQuery escapes text to go in quotes in a drive query
+func escapeQuery(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(text)
+}
+
+//MoveFile moves the file out of its folder and into the folder with folderID
+func (f *FileRetriever) MoveFile(ctx context.Context, info *fileretrieveriface.RenameInfo, folderID string) error {
+	return f.retry(ctx, "move file "+info.ID, func() error {
+		if err := f.writeLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		call := f.drive.Files.Update(info.ID, &drive.File{}).AddParents(folderID)
+		if info.ParentID != "" {
+			call = call.RemoveParents(info.ParentID)
+		}
+		_, err := call.Context(ctx).Do()
+		return err
+	})
+}
+
+//TrashFile moves the file to the drive trash, where it can be restored from
+func (f *FileRetriever) TrashFile(ctx context.Context, info *fileretrieveriface.RenameInfo) error {
+	return f.retry(ctx, "trash file "+info.ID, func() error {
+		if err := f.writeLimiter.Wait(ctx); err != nil {
+			return err
+		}
+		_, err := f.drive.Files.Trash(info.ID).Context(ctx).Do()
+		return err
+	})
+}
+
+//isNotFound returns true when a drive call failed because the resource doesn't exist
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*googleapi.Error)
+	return ok && apiErr.Code == http.StatusNotFound
+}
+
+//orDefault returns value, or def when value isn't set
+func orDefault(value int, def int) int {
+	if value <= 0 {
+		return def
+	}
+	return value
 }
 
 //All Code below was edited but used from the Google drive quickstart quide for golang at https://developers.google.com/drive/api/v3/quickstart/go
@@ -230,30 +495,80 @@ func NewFileRetriever(logger loggeriface.Service, config *config.Config) fileret
 		config: config,
 	}
 
-	//establish rate limiter for reads/writes
-	wl := rate.NewLimiter(rate.Every(time.Minute/writeLimitPerMinute), 1)
-	rl := rate.NewLimiter(rate.Every(time.Minute/readLimitPerMinute), 1)
-	fileRetriever.readLimiter = rl
-	fileRetriever.writeLimiter = wl
+	//establish rate limiter for reads/writes, shared with any other retriever using the same credentials
+	fileRetriever.readLimiter = sharedLimiter(config.CredentialsPath, "read",
+		orDefault(config.ReadLimitPerMinute, defaultReadLimitPerMinute), orDefault(config.ReadBurst, defaultLimiterBurst))
+	fileRetriever.writeLimiter = sharedLimiter(config.CredentialsPath, "write",
+		orDefault(config.WriteLimitPerMinute, defaultWriteLimitPerMinute), orDefault(config.WriteBurst, defaultLimiterBurst))
+
+	retryPolicy, err := newRetryPolicy(config)
+	if err != nil {
+		logger.Fatal("Invalid retry configuration: " + err.Error())
+	}
+	fileRetriever.retryPolicy = retryPolicy
 	
-	b, err := ioutil.ReadFile(config.CredentialsPath)
+	fileRetriever.drive = fileRetriever.sharedDriveService()
+	return fileRetriever
+}
+
+//driveServices holds the drive service of every set of credentials and token, so a
+//retriever made for a changed config reuses the authorized client instead of setting it up again
+var driveServices = struct {
+	sync.Mutex
+	byKey map[string]*drive.Service
+}{byKey: make(map[string]*drive.Service)}
+
+//sharedDriveService returns the drive service for the configured credentials and token,
+//authorizing a new client the first time they are used
+func (f *FileRetriever) sharedDriveService() *drive.Service {
+	key := f.config.CredentialsPath + "|" + f.config.TokenPath
+	if abs, err := filepath.Abs(f.config.CredentialsPath); err == nil {
+		key = abs + "|" + f.config.TokenPath
+	}
+
+	driveServices.Lock()
+	defer driveServices.Unlock()
+	if service, ok := driveServices.byKey[key]; ok {
+		return service
+	}
+
+	b, err := ioutil.ReadFile(f.config.CredentialsPath)
 	if err != nil {
-		logger.Fatal("Unable to read client secret file: " + err.Error())
+		f.logger.Fatal("Unable to read client secret file: " + err.Error())
 	}
 
 	// If modifying these scopes, delete your previously saved token.json.
 	oauthConfig, err := google.ConfigFromJSON(b, drive.DriveScope)
 	if err != nil {
-		logger.Fatal("Unable to parse client secret file to config: " + err.Error())
+		f.logger.Fatal("Unable to parse client secret file to config: " + err.Error())
 	}
-	client := fileRetriever.getClient(oauthConfig)
-	
-	drive, err := drive.NewService(context.Background(), option.WithHTTPClient(client))
+	client := f.getClient(oauthConfig)
+
+	service, err := drive.NewService(context.Background(), option.WithHTTPClient(client))
 	if err != nil {
-		logger.Fatal("Unable to retrieve Drive client: " + err.Error())
+		f.logger.Fatal("Unable to retrieve Drive client: " + err.Error())
 	}
-	fileRetriever.drive = drive
-	return fileRetriever
+	driveServices.byKey[key] = service
+	return service
+}
+
+//Authenticate runs the oauth flow and saves a new token to config.TokenPath,
+//replacing any token that is already there
+func Authenticate(logger loggeriface.Service, config *config.Config) error {
+	fileRetriever := &FileRetriever{
+		logger: logger,
+		config: config,
+	}
+	b, err := ioutil.ReadFile(config.CredentialsPath)
+	if err != nil {
+		return fmt.Errorf("unable to read client secret file: %s", err.Error())
+	}
+	oauthConfig, err := google.ConfigFromJSON(b, drive.DriveScope)
+	if err != nil {
+		return fmt.Errorf("unable to parse client secret file to config: %s", err.Error())
+	}
+	fileRetriever.saveToken(fileRetriever.getTokenFromWeb(oauthConfig))
+	return nil
 }
 
 // Retrieve a token, saves the token, then returns the generated client.
@@ -0,0 +1,84 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/davidparks11/file-renamer/pkg/journal/journaliface"
+)
+
+const (
+	//defaultJournalPath the location written if the journal path is not edited in config.json
+	defaultJournalPath = "file_renamer_journal.jsonl"
+)
+
+var _ journaliface.Journal = &Journal{}
+
+//Journal appends entries as json lines to a local file
+type Journal struct {
+	path string
+	mu   sync.Mutex
+}
+
+//NewJournal serves a journal that writes to path
+func NewJournal(path string) journaliface.Journal {
+	if path == "" {
+		path = defaultJournalPath
+	}
+	return &Journal{path: path}
+}
+
+//Record appends an entry to the journal and syncs it to disk before returning
+func (j *Journal) Record(entry *journaliface.Entry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	file, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(b, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+//Entries returns every entry in the journal in the order they were recorded
+func (j *Journal) Entries() ([]*journaliface.Entry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	file, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []*journaliface.Entry
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		entry := &journaliface.Entry{}
+		if err = json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fmt.Errorf("%s line %d: %s", j.path, line, err.Error())
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
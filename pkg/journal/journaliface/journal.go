@@ -0,0 +1,31 @@
+package journaliface
+
+import "time"
+
+const (
+	//ActionRename marks an entry written when a file was renamed
+	ActionRename = "rename"
+	//ActionUndo marks an entry written when a rename was reverted
+	ActionUndo = "undo"
+)
+
+//Entry is a single record of a file being renamed or reverted
+type Entry struct {
+	Action    string    `json:"action"`
+	RunID     string    `json:"runID"`
+	FileID    string    `json:"fileID"`
+	OldName   string    `json:"oldName"`
+	NewName   string    `json:"newName"`
+	Timestamp time.Time `json:"timestamp"`
+	//Job is the name of the job that renamed the file, empty when the config has no jobs
+	Job string `json:"job,omitempty"`
+	//OldParentID and NewParentID are the folders the file was moved from and to, empty when it wasn't moved
+	OldParentID string `json:"oldParentID,omitempty"`
+	NewParentID string `json:"newParentID,omitempty"`
+}
+
+//Journal durably records every change made to file names
+type Journal interface {
+	Record(*Entry) error
+	Entries() ([]*Entry, error)
+}
@@ -0,0 +1,41 @@
+package logger
+
+import (
+	"github.com/davidparks11/file-renamer/pkg/logger/loggeriface"
+)
+
+var _ loggeriface.Service = &PrefixLogger{}
+
+//PrefixLogger tags every message with a prefix, such as the name of a job, before
+//passing it on to another log service
+type PrefixLogger struct {
+	prefix string
+	logger loggeriface.Service
+}
+
+//NewPrefixLogger serves a log service that writes to logger with every message starting with [prefix]
+func NewPrefixLogger(logger loggeriface.Service, prefix string) loggeriface.Service {
+	return &PrefixLogger{
+		prefix: "[" + prefix + "] ",
+		logger: logger,
+	}
+}
+
+func (p *PrefixLogger) Info(msg string) {
+	p.logger.Info(p.prefix + msg)
+}
+
+func (p *PrefixLogger) Error(msg string) {
+	p.logger.Error(p.prefix + msg)
+}
+
+func (p *PrefixLogger) Fatal(msg string) {
+	p.logger.Fatal(p.prefix + msg)
+}
+
+func (p *PrefixLogger) Warn(msg string) {
+	p.logger.Warn(p.prefix + msg)
+}
+
+//Stop does nothing, the wrapped service is stopped by whoever created it
+func (p *PrefixLogger) Stop() {}
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/davidparks11/file-renamer/pkg/logger/loggeriface"
@@ -36,6 +37,11 @@ type Service struct {
 	errorLogger      *log.Logger
 	warnLogger       *log.Logger
 	infoLogger       *log.Logger
+	//now tells the time, it's time.Now outside of tests
+	now func() time.Time
+	//mu keeps goroutines logging at once from opening the next day's file twice, or
+	//writing to the file being closed
+	mu sync.Mutex
 }
 
 //NewLogService serves a new log Service
@@ -66,6 +72,7 @@ func NewLogService(level int, logPath string, logToConsole bool) loggeriface.Ser
 		infoLogger:       log.New(logFile, "INFO: ", log.Ldate|log.Ltime),
 		errorLogger:      log.New(logFile, "ERROR: ", log.Ldate|log.Ltime),
 		fatalLogger:      log.New(logFile, "FATAL: ", log.Ldate|log.Ltime),
+		now:              time.Now,
 	}
 	return &service
 }
@@ -98,9 +105,9 @@ func ParseLogLevel(logLevel string) (level int) {
 
 //Fatal writes a fatal message to logs and exits program
 func (s *Service) Fatal(msg string) {
-	if s.isNewLogDay() {
-		s.refresh()
-	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshIfNewDay()
 	if s.logToConsole {
 		fmt.Println("FATAL: ", msg)
 	}
@@ -113,14 +120,7 @@ func (s *Service) Error(msg string) {
 	if !s.isLoggable(ERROR) {
 		return
 	}
-	if s.isNewLogDay() {
-		s.refresh()
-	}
-	if s.logToConsole {
-		fmt.Println("ERROR: ", msg)
-	}
-
-	s.errorLogger.Println(msg)
+	s.write(s.errorLogger, "ERROR: ", msg)
 }
 
 //Warn writes a warning message to logs
@@ -128,14 +128,7 @@ func (s *Service) Warn(msg string) {
 	if !s.isLoggable(WARN) {
 		return
 	}
-	if s.isNewLogDay() {
-		s.refresh()
-	}
-	if s.logToConsole {
-		fmt.Println("WARN: ", msg)
-	}
-
-	s.warnLogger.Println(msg)
+	s.write(s.warnLogger, "WARN: ", msg)
 }
 
 //Info writes an info message to logs
@@ -143,22 +136,35 @@ func (s *Service) Info(msg string) {
 	if !s.isLoggable(INFO) {
 		return
 	}
-	if s.isNewLogDay() {
-		s.refresh()
-	}
+	s.write(s.infoLogger, "INFO: ", msg)
+}
+
+//write logs msg with logger. The lock is held from the day check through the write, so a
+//goroutine never writes to a file another goroutine has just closed
+func (s *Service) write(logger *log.Logger, label string, msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshIfNewDay()
 	if s.logToConsole {
-		fmt.Println("INFO: ", msg)
+		fmt.Println(label, msg)
 	}
 
-	s.infoLogger.Println(msg)
+	logger.Println(msg)
 }
 
 func (s *Service) isLoggable(msgLevel int) bool {
 	return msgLevel <= s.Level
 }
 
+//refreshIfNewDay moves logging to a new file once the day changes, the caller holds mu
+func (s *Service) refreshIfNewDay() {
+	if s.isNewLogDay() {
+		s.refresh()
+	}
+}
+
 func (s *Service) isNewLogDay() bool {
-	return s.fileCreationDate.Day() != time.Now().Day()
+	return s.fileCreationDate.Day() != s.now().Day()
 }
 
 func newLogFileName(creationTime *time.Time, path string) string {
@@ -179,7 +185,7 @@ func (s *Service) refresh() {
 	s.file.Close()
 
 	//time for file creation
-	now := time.Now()
+	now := s.now()
 	logFileName := newLogFileName(&now, s.path)
 
 	//open log file
@@ -196,10 +202,13 @@ func (s *Service) refresh() {
 	s.warnLogger.SetOutput(logFile)
 	s.errorLogger.SetOutput(logFile)
 	s.infoLogger.SetOutput(logFile)
+	s.fatalLogger.SetOutput(logFile)
 }
 
 //Stop performs logging service clean up
 func (s *Service) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.file != nil {
 		s.file.Close()
 	}
@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+//gatedWriter holds the first write made through it until it's released
+type gatedWriter struct {
+	w        io.Writer
+	entered  chan struct{}
+	release  chan struct{}
+	blocking sync.Once
+}
+
+func (g *gatedWriter) Write(p []byte) (int, error) {
+	g.blocking.Do(func() {
+		close(g.entered)
+		<-g.release
+	})
+	return g.w.Write(p)
+}
+
+var _ = Describe("Service", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "logger")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should finish a write before another goroutine moves to the next day's file", func() {
+		service := NewLogService(INFO, dir, false).(*Service)
+		defer service.Stop()
+		var mu sync.Mutex
+		today := time.Now()
+		clock := today
+		service.now = func() time.Time {
+			mu.Lock()
+			defer mu.Unlock()
+			return clock
+		}
+		gate := &gatedWriter{w: service.file, entered: make(chan struct{}), release: make(chan struct{})}
+		service.infoLogger.SetOutput(gate)
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			service.Info("before midnight")
+		}()
+		<-gate.entered
+
+		//the day changes while the first message is being written
+		mu.Lock()
+		clock = today.AddDate(0, 0, 1)
+		tomorrow := clock
+		mu.Unlock()
+		go func() {
+			defer wg.Done()
+			service.Info("after midnight")
+		}()
+		time.Sleep(50 * time.Millisecond)
+		close(gate.release)
+		wg.Wait()
+
+		b, err := ioutil.ReadFile(newLogFileName(&today, dir))
+		Expect(err).To(BeNil())
+		Expect(string(b)).To(ContainSubstring("before midnight"))
+		Expect(string(b)).NotTo(ContainSubstring("after midnight"))
+		b, err = ioutil.ReadFile(newLogFileName(&tomorrow, dir))
+		Expect(err).To(BeNil())
+		Expect(strings.Count(string(b), "after midnight")).To(Equal(1))
+	})
+})
@@ -0,0 +1,34 @@
+package schedule
+
+import (
+	"context"
+
+	"github.com/davidparks11/file-renamer/pkg/schedule/scheduleiface"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ scheduleiface.Scheduler = &MockScheduler{}
+
+//MockScheduler records the jobs scheduled on it without running them
+type MockScheduler struct {
+	mock.Mock
+}
+
+//ScheduleJob mocks adding a cron job, the process is never run
+func (m *MockScheduler) ScheduleJob(schedule string, process func(ctx context.Context)) (scheduleiface.JobID, error) {
+	args := m.Called(schedule)
+	return args.Get(0).(scheduleiface.JobID), args.Error(1)
+}
+
+//RemoveJob mocks removing a cron job
+func (m *MockScheduler) RemoveJob(id scheduleiface.JobID) {
+	m.Called(id)
+}
+
+//Context returns a context that's never cancelled
+func (m *MockScheduler) Context() context.Context {
+	return context.Background()
+}
+
+//Run returns straight away
+func (m *MockScheduler) Run() {}
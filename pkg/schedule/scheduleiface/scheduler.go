@@ -1,7 +1,16 @@
 package scheduleiface
 
+import "context"
+
 //Scheduler contains methods to facilitate 
 type Scheduler interface {
-	ScheduleJob(schedule string, process func()) error
+	//ScheduleJob runs process on schedule with a context that's cancelled when the scheduler is interrupted
+	ScheduleJob(schedule string, process func(ctx context.Context)) (JobID, error)
+	RemoveJob(id JobID)
+	//Context returns the context given to jobs
+	Context() context.Context
 	Run()
-}
\ No newline at end of file
+}
+
+//JobID identifies a scheduled job so it can be removed
+type JobID int
\ No newline at end of file
@@ -1,6 +1,7 @@
 package schedule
 
 import (
+	"context"
 	"os"
 	"os/signal"
 	"syscall"
@@ -17,21 +18,51 @@ type Scheduler struct {
 	cron *cron.Cron
 	sigChannel chan os.Signal
 	logger loggeriface.Service
+	//ctx is given to every job, it's cancelled on SIGINT or SIGTERM
+	ctx context.Context
+	cancel context.CancelFunc
 }
 
+//NewScheduleService serves a scheduler that listens for SIGINT and SIGTERM from
+//the start, so jobs run before the scheduler starts can be interrupted too
 func NewScheduleService(logger loggeriface.Service) scheduleiface.Scheduler {
 	cronLogger := cron.DefaultLogger
-	return &Scheduler{
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scheduler{
 		cron: cron.New(cron.WithLogger(cronLogger), cron.WithChain(cron.SkipIfStillRunning(cronLogger))),
-		sigChannel: make(chan os.Signal),
+		sigChannel: make(chan os.Signal, 1),
 		logger: logger,
+		ctx: ctx,
+		cancel: cancel,
 	}
+	signal.Notify(s.sigChannel, syscall.SIGINT, syscall.SIGTERM)
+	go s.awaitInterrupt()
+	return s
+}
+
+//awaitInterrupt cancels the context of the jobs on the first interrupt
+func (s *Scheduler) awaitInterrupt() {
+	<-s.sigChannel
+	s.logger.Info("Interrupted, running jobs finish the files they're on and stop")
+	s.cancel()
 }
 
 //ScheduleJob schedules a function to run on a cron job schedule
-func (s *Scheduler) ScheduleJob(schedule string, process func()) error {
-	_, err := s.cron.AddFunc(schedule, process)
-	return err
+func (s *Scheduler) ScheduleJob(schedule string, process func(ctx context.Context)) (scheduleiface.JobID, error) {
+	id, err := s.cron.AddFunc(schedule, func() {
+		process(s.ctx)
+	})
+	return scheduleiface.JobID(id), err
+}
+
+//Context returns the context given to jobs, for running a job outside of its schedule
+func (s *Scheduler) Context() context.Context {
+	return s.ctx
+}
+
+//RemoveJob stops a job from being run again. A run already in progress isn't interrupted
+func (s *Scheduler) RemoveJob(id scheduleiface.JobID) {
+	s.cron.Remove(cron.EntryID(id))
 }
 
 func (s *Scheduler) InterrupetChannel() chan os.Signal {
@@ -46,13 +77,10 @@ func (s *Scheduler) initInterreupt() {
 	s.sigChannel = make (chan os.Signal, 1)
 }
 
+//Run starts the schedules and blocks until interrupted, then waits for running jobs to stop
 func (s *Scheduler) Run() {
 	s.cron.Start()
-	s.initInterreupt()
-	signal.Notify(s.sigChannel, syscall.SIGINT, syscall.SIGTERM)
-	<-s.sigChannel
-	s.cron.Stop()
-	if s.cron == nil {
-		s.logger.Info("Cron is nil after stop")
-	}
+	<-s.ctx.Done()
+	<-s.cron.Stop().Done()
+	s.logger.Info("Every running job has stopped")
 }